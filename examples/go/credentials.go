@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/youmark/pkcs8"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// loadTLSCredentials loads the CA, certificate chain and private key that
+// grpchub.NewGrpcHubClient expects from a combined PEM file or a PKCS#12
+// (.p12/.pfx) bundle.
+//
+// The key may be PKCS#8, PKCS#1 or SEC1; only PKCS#8 keys may be encrypted
+// with password. Bundles are decoded with go-pkcs12 and encrypted PKCS#8 keys
+// with youmark/pkcs8. The certificate whose public key matches the key is
+// the leaf; the certificates that issue it form the chain; every other
+// certificate is trusted as a CA for the hub.
+func loadTLSCredentials(path, password string) (caPEM, certPEM, keyPEM []byte, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var key crypto.PrivateKey
+	var certs []*x509.Certificate
+	switch ext := strings.ToLower(filepath.Ext(path)); {
+	case ext == ".p12" || ext == ".pfx", !bytes.Contains(data, []byte("-----BEGIN ")):
+		var leaf *x509.Certificate
+		var caCerts []*x509.Certificate
+		key, leaf, caCerts, err = pkcs12.DecodeChain(data, password)
+		certs = append([]*x509.Certificate{leaf}, caCerts...)
+	default:
+		key, certs, err = decodePEM(data, password)
+	}
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	caPEM, certPEM, keyPEM, err = encodeCredentials(key, certs)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return caPEM, certPEM, keyPEM, nil
+}
+
+func decodePEM(data []byte, password string) (crypto.PrivateKey, []*x509.Certificate, error) {
+	var key crypto.PrivateKey
+	var certs []*x509.Certificate
+	for n := 1; ; n++ {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, nil, fmt.Errorf("PEM block %d: %w", n, err)
+			}
+			certs = append(certs, cert)
+		case "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY", "ENCRYPTED PRIVATE KEY":
+			if key != nil {
+				return nil, nil, fmt.Errorf("PEM block %d: more than one private key", n)
+			}
+			k, err := parsePrivateKeyBlock(block, password)
+			if err != nil {
+				return nil, nil, fmt.Errorf("PEM block %d (%s): %w", n, block.Type, err)
+			}
+			key = k
+		}
+	}
+	return key, certs, nil
+}
+
+// errLegacyEncryptedKey is returned for keys encrypted the legacy OpenSSL
+// way (Proc-Type: 4,ENCRYPTED), whose RFC 1423 encryption is insecure.
+var errLegacyEncryptedKey = errors.New("legacy OpenSSL key encryption is not supported; " +
+	"convert the key with: openssl pkcs8 -topk8 -in key.pem -v2 aes-256-cbc -out key.p8.pem")
+
+func parsePrivateKeyBlock(block *pem.Block, password string) (crypto.PrivateKey, error) {
+	if strings.Contains(block.Headers["Proc-Type"], "ENCRYPTED") {
+		return nil, errLegacyEncryptedKey
+	}
+
+	switch block.Type {
+	case "ENCRYPTED PRIVATE KEY":
+		if password == "" {
+			return nil, errors.New("key is encrypted but no password was given")
+		}
+		return pkcs8.ParsePKCS8PrivateKey(block.Bytes, []byte(password))
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+}
+
+// encodeCredentials pairs key with its certificate and splits certs into the
+// chain presented to the hub and the CAs used to verify it.
+func encodeCredentials(key crypto.PrivateKey, certs []*x509.Certificate) (caPEM, certPEM, keyPEM []byte, err error) {
+	if key == nil {
+		return nil, nil, nil, errors.New("no private key found")
+	}
+	if len(certs) == 0 {
+		return nil, nil, nil, errors.New("no certificate found")
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+
+	// 与私钥匹配的证书才是叶子证书
+	pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("unsupported public key type %T", signer.Public())
+	}
+	i := slices.IndexFunc(certs, func(c *x509.Certificate) bool {
+		return pub.Equal(c.PublicKey)
+	})
+	if i < 0 {
+		return nil, nil, nil, errors.New("no certificate matches the private key")
+	}
+	chain := []*x509.Certificate{certs[i]}
+	rest := slices.Delete(slices.Clone(certs), i, i+1)
+
+	// 沿签发关系补齐中间证书，自签名的根证书留作信任锚
+	for {
+		last := chain[len(chain)-1]
+		if isSelfSigned(last) {
+			break
+		}
+		j := slices.IndexFunc(rest, func(c *x509.Certificate) bool {
+			return !isSelfSigned(c) && last.CheckSignatureFrom(c) == nil
+		})
+		if j < 0 {
+			break
+		}
+		chain = append(chain, rest[j])
+		rest = slices.Delete(rest, j, j+1)
+	}
+	if len(rest) == 0 {
+		return nil, nil, nil, errors.New("no CA certificate found besides the certificate chain")
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("marshal private key: %w", err)
+	}
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	for _, c := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	for _, c := range rest {
+		caPEM = append(caPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	return caPEM, certPEM, keyPEM, nil
+}
+
+func isSelfSigned(c *x509.Certificate) bool {
+	return bytes.Equal(c.RawIssuer, c.RawSubject) && c.CheckSignatureFrom(c) == nil
+}
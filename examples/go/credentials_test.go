@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The fixtures in testdata are written by testdata/gen.sh: an echo-client
+// leaf issued by an intermediate that the root CA in ca.crt issues.
+
+func TestLoadTLSCredentials(t *testing.T) {
+	for _, tt := range []struct {
+		file, password string
+	}{
+		{"client.pem", ""},
+		{"client-ec.pem", ""},
+		{"client-rsa.pem", ""},
+		{"client-encrypted.pem", "secret"},
+		{"client.p12", "secret"},
+		{"client-legacy.p12", "secret"},
+	} {
+		t.Run(tt.file, func(t *testing.T) {
+			caPEM, certPEM, keyPEM, err := loadTLSCredentials(filepath.Join("testdata", tt.file), tt.password)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			chain := parseCertificates(t, certPEM)
+			if len(chain) != 2 {
+				t.Fatalf("chain has %d certificates, want leaf and intermediate", len(chain))
+			}
+			if got := chain[0].Subject.CommonName; got != "echo-client" {
+				t.Errorf("leaf CN = %q, want echo-client", got)
+			}
+			if !chain[1].Equal(readCertificate(t, "intermediate.crt")) {
+				t.Errorf("chain[1] = %q, want the intermediate", chain[1].Subject.CommonName)
+			}
+
+			cas := parseCertificates(t, caPEM)
+			if len(cas) != 1 || !cas[0].Equal(readCertificate(t, "ca.crt")) {
+				t.Errorf("CAs = %v, want only the root CA", cas)
+			}
+
+			block, _ := pem.Decode(keyPEM)
+			if block == nil || block.Type != "PRIVATE KEY" {
+				t.Fatalf("key is not a PRIVATE KEY block")
+			}
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !key.(crypto.Signer).Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(chain[0].PublicKey) {
+				t.Error("key does not match the leaf certificate")
+			}
+		})
+	}
+}
+
+func TestLoadTLSCredentials_Password(t *testing.T) {
+	for _, tt := range []struct {
+		file, password string
+	}{
+		{"client-encrypted.pem", ""},
+		{"client-encrypted.pem", "wrong"},
+		{"client.p12", "wrong"},
+	} {
+		if _, _, _, err := loadTLSCredentials(filepath.Join("testdata", tt.file), tt.password); err == nil {
+			t.Errorf("%s with password %q: expected an error", tt.file, tt.password)
+		}
+	}
+}
+
+func TestLoadTLSCredentials_LegacyEncryptedKey(t *testing.T) {
+	_, _, _, err := loadTLSCredentials(filepath.Join("testdata", "client-legacy-encrypted.pem"), "secret")
+	if !errors.Is(err, errLegacyEncryptedKey) {
+		t.Errorf("err = %v, want errLegacyEncryptedKey", err)
+	}
+}
+
+func TestLoadTLSCredentials_NoCA(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "client.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 去掉根证书后只剩叶子和中间证书，没有可信任的 CA
+	var out []byte
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			if cert, err := x509.ParseCertificate(block.Bytes); err == nil && cert.Subject.CommonName == "GrpcHub Test CA" {
+				continue
+			}
+		}
+		out = append(out, pem.EncodeToMemory(block)...)
+	}
+	path := filepath.Join(t.TempDir(), "client.pem")
+	if err := os.WriteFile(path, out, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := loadTLSCredentials(path, ""); err == nil {
+		t.Error("expected an error without a CA certificate")
+	}
+}
+
+func readCertificate(t *testing.T, name string) *x509.Certificate {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parseCertificates(t, data)[0]
+}
+
+func parseCertificates(t *testing.T, data []byte) []*x509.Certificate {
+	t.Helper()
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs
+}
@@ -4,7 +4,9 @@ go 1.24.2
 
 require (
 	github.com/lisoboss/grpchub-go v0.1.0
+	github.com/youmark/pkcs8 v0.0.0-20240726163527-a2c0da244d78
 	google.golang.org/protobuf v1.36.6
+	software.sslmate.com/src/go-pkcs12 v0.5.0
 )
 
 require (
@@ -13,6 +15,7 @@ require (
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/klauspost/compress v1.17.8 // indirect
 	github.com/mostynb/go-grpc-compression v1.2.3 // indirect
+	golang.org/x/crypto v0.36.0 // indirect
 	golang.org/x/net v0.38.0 // indirect
 	golang.org/x/sys v0.31.0 // indirect
 	golang.org/x/text v0.23.0 // indirect
@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/pem"
 	"fmt"
 	"log"
 	"os"
@@ -38,44 +37,18 @@ type PingResponse struct {
 	Timestamp int64  `json:"timestamp"`
 }
 
-// Load TLS credentials from PEM file
-func loadTLSCredentialsFromPEM(pemFile string) ([]byte, []byte, []byte, error) {
-	data, err := os.ReadFile(pemFile)
-	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to read pem file: %w", err)
-	}
-
-	var certPEM, keyPEM, caPEM []byte
-	for {
-		var block *pem.Block
-		block, data = pem.Decode(data)
-		if block == nil {
-			break
-		}
-		switch block.Type {
-		case "CERTIFICATE":
-			// First certificate is client cert, last one is CA
-			if certPEM == nil {
-				certPEM = pem.EncodeToMemory(block)
-			} else {
-				caPEM = append(caPEM, pem.EncodeToMemory(block)...)
-			}
-		case "PRIVATE KEY":
-			keyPEM = pem.EncodeToMemory(block)
-		}
+// Certificate file, ../../deploy/certs/client.pem unless GRPCHUB_CERT_FILE is set
+func certFile() string {
+	if f := os.Getenv("GRPCHUB_CERT_FILE"); f != "" {
+		return f
 	}
-
-	if certPEM == nil || keyPEM == nil || caPEM == nil {
-		return nil, nil, nil, fmt.Errorf("incomplete PEM data (cert/key/ca)")
-	}
-
-	return caPEM, certPEM, keyPEM, nil
+	return "../../deploy/certs/client.pem"
 }
 
 // Create GrpcHub client
 func createGrpcHubClient() (*grpchub.GrpcHubClient, error) {
-	// Load TLS credentials from PEM file
-	caPEM, certPEM, keyPEM, err := loadTLSCredentialsFromPEM("../../deploy/certs/client.pem")
+	// Load TLS credentials from PEM file or PKCS#12 bundle
+	caPEM, certPEM, keyPEM, err := loadTLSCredentials(certFile(), os.Getenv("GRPCHUB_CERT_PASSWORD"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to load TLS credentials: %w", err)
 	}
@@ -169,6 +142,7 @@ func main() {
 		fmt.Println("")
 		fmt.Println("Note: Make sure GrpcHub server is running and certificates are available at:")
 		fmt.Println("  ../../deploy/certs/client.pem")
+		fmt.Println("  (or set GRPCHUB_CERT_FILE, and GRPCHUB_CERT_PASSWORD for encrypted keys)")
 		os.Exit(1)
 	}
 
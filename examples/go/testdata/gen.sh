@@ -0,0 +1,54 @@
+#!/bin/bash
+# Regenerates the credential fixtures used by credentials_test.go:
+# a root CA, an intermediate CA and an echo-client leaf issued by the
+# intermediate, packed the ways loadTLSCredentials accepts them.
+# Password-protected files use the password "secret".
+set -euo pipefail
+cd "$(dirname "$0")"
+
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+
+openssl req -x509 -newkey ec -pkeyopt ec_paramgen_curve:P-256 -nodes -days 36500 \
+    -subj "/CN=GrpcHub Test CA" -keyout "$tmp/ca.key" -out ca.crt \
+    -addext "basicConstraints=critical,CA:TRUE" -addext "keyUsage=critical,keyCertSign,cRLSign"
+
+openssl req -newkey ec -pkeyopt ec_paramgen_curve:P-256 -nodes \
+    -subj "/CN=GrpcHub Test Intermediate" -keyout "$tmp/int.key" -out "$tmp/int.csr"
+printf "basicConstraints=critical,CA:TRUE\nkeyUsage=critical,keyCertSign,cRLSign\n" > "$tmp/int.ext"
+openssl x509 -req -in "$tmp/int.csr" -CA ca.crt -CAkey "$tmp/ca.key" -CAcreateserial -CAserial "$tmp/serial" \
+    -days 36500 -extfile "$tmp/int.ext" -out "$tmp/int.crt"
+
+openssl req -newkey ec -pkeyopt ec_paramgen_curve:P-256 -nodes \
+    -subj "/CN=echo-client" -keyout "$tmp/client.key" -out "$tmp/client.csr"
+printf "extendedKeyUsage=clientAuth\n" > "$tmp/client.ext"
+openssl x509 -req -in "$tmp/client.csr" -CA "$tmp/int.crt" -CAkey "$tmp/int.key" -CAcreateserial -CAserial "$tmp/serial" \
+    -days 36500 -extfile "$tmp/client.ext" -out "$tmp/client.crt"
+
+# The CA comes first so the loader has to find the leaf by its key.
+cat ca.crt "$tmp/client.crt" "$tmp/client.key" "$tmp/int.crt" > client.pem
+
+openssl pkcs8 -topk8 -in "$tmp/client.key" -v2 aes-256-cbc -passout pass:secret -out "$tmp/client.enc.key"
+cat "$tmp/client.crt" "$tmp/client.enc.key" "$tmp/int.crt" ca.crt > client-encrypted.pem
+
+# The same key as SEC1, and SEC1 encrypted the legacy OpenSSL way
+# (Proc-Type: 4,ENCRYPTED), which the loader refuses.
+openssl ec -in "$tmp/client.key" -out "$tmp/client.sec1.key"
+cat "$tmp/client.crt" "$tmp/client.sec1.key" "$tmp/int.crt" ca.crt > client-ec.pem
+openssl ec -in "$tmp/client.key" -aes256 -passout pass:secret -out "$tmp/client.legacy.key"
+cat "$tmp/client.crt" "$tmp/client.legacy.key" "$tmp/int.crt" ca.crt > client-legacy-encrypted.pem
+
+# An RSA leaf whose key is PKCS#1.
+openssl req -newkey rsa:2048 -nodes \
+    -subj "/CN=echo-client" -keyout "$tmp/client-rsa.key" -out "$tmp/client-rsa.csr"
+openssl x509 -req -in "$tmp/client-rsa.csr" -CA "$tmp/int.crt" -CAkey "$tmp/int.key" -CAcreateserial -CAserial "$tmp/serial" \
+    -days 36500 -extfile "$tmp/client.ext" -out "$tmp/client-rsa.crt"
+openssl rsa -in "$tmp/client-rsa.key" -traditional -out "$tmp/client-rsa.pkcs1.key"
+cat "$tmp/client-rsa.crt" "$tmp/client-rsa.pkcs1.key" "$tmp/int.crt" ca.crt > client-rsa.pem
+
+openssl pkcs12 -export -inkey "$tmp/client.key" -in "$tmp/client.crt" \
+    -certfile <(cat "$tmp/int.crt" ca.crt) -passout pass:secret -out client.p12
+openssl pkcs12 -export -legacy -inkey "$tmp/client.key" -in "$tmp/client.crt" \
+    -certfile <(cat "$tmp/int.crt" ca.crt) -passout pass:secret -out client-legacy.p12
+
+cp "$tmp/int.crt" intermediate.crt
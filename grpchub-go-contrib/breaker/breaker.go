@@ -0,0 +1,278 @@
+// Package breaker is a circuit breaker for calls routed through the hub.
+//
+// A Breaker belongs to one grpcx client, and so to one target component.
+// It trips when too many calls in a window fail with UNAVAILABLE or
+// DEADLINE_EXCEEDED, which includes the hub's COMPONENT_OFFLINE error.
+// It then fails calls at once until the open timeout has passed, and lets
+// a probe call through to decide whether to close again:
+//
+//	b := breaker.New(breaker.WithPerMethod())
+//	conn, _ := grpcx.NewClient("echo-server", ghc,
+//		grpcx.WithMiddleware(b.Middleware()),
+//		grpcx.WithStreamTransportMiddleware(b.StreamMiddleware()),
+//	)
+package breaker
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/lisoboss/grpchub-go/middleware"
+	"github.com/lisoboss/grpchub/grpchub-go-contrib/internal/wire"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ReasonCircuitOpen is the ErrorInfo reason of calls the breaker rejects.
+// Their domain is "grpchub", the domain of the hub's own errors.
+const ReasonCircuitOpen = "CIRCUIT_OPEN"
+
+type state int
+
+const (
+	closed state = iota
+	open
+	halfOpen
+)
+
+type options struct {
+	failureRatio float64
+	minRequests  int
+	window       time.Duration
+	openTimeout  time.Duration
+	perMethod    bool
+	codes        []codes.Code
+}
+
+// Option configures a Breaker.
+type Option func(*options)
+
+// WithFailureRatio sets the share of failed calls in a window that trips
+// the breaker. The default is 0.5.
+func WithFailureRatio(ratio float64) Option {
+	return func(o *options) {
+		o.failureRatio = ratio
+	}
+}
+
+// WithMinRequests sets how many calls a window needs before the breaker
+// may trip. The default is 10.
+func WithMinRequests(n int) Option {
+	return func(o *options) {
+		o.minRequests = n
+	}
+}
+
+// WithWindow sets how long calls are counted before the counts start
+// over. The default is 10 seconds.
+func WithWindow(d time.Duration) Option {
+	return func(o *options) {
+		o.window = d
+	}
+}
+
+// WithOpenTimeout sets how long the breaker stays open before it lets a
+// probe call through. The default is 5 seconds.
+func WithOpenTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.openTimeout = d
+	}
+}
+
+// WithPerMethod keeps a separate circuit for every method, so one failing
+// method does not block the others.
+func WithPerMethod() Option {
+	return func(o *options) {
+		o.perMethod = true
+	}
+}
+
+// WithFailureCodes replaces the status codes counted as failures. The
+// default is UNAVAILABLE and DEADLINE_EXCEEDED.
+func WithFailureCodes(c ...codes.Code) Option {
+	return func(o *options) {
+		o.codes = c
+	}
+}
+
+// Breaker tracks the calls to one target component.
+type Breaker struct {
+	opts options
+	now  func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	state state
+	// generation changes with every state transition, so done can tell
+	// the result of a call allowed in an earlier state, such as a slow
+	// call from before the circuit opened, from the probe's.
+	generation  uint64
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probing     bool
+}
+
+// New returns a closed Breaker.
+func New(opts ...Option) *Breaker {
+	o := options{
+		failureRatio: 0.5,
+		minRequests:  10,
+		window:       10 * time.Second,
+		openTimeout:  5 * time.Second,
+		codes:        []codes.Code{codes.Unavailable, codes.DeadlineExceeded},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Breaker{
+		opts:     o,
+		now:      time.Now,
+		circuits: make(map[string]*circuit),
+	}
+}
+
+// Middleware returns the breaker as a client middleware.Middleware.
+func (b *Breaker) Middleware() middleware.Middleware {
+	return func(next middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (any, error) {
+			key := b.key(ctx)
+			gen, err := b.allow(key)
+			if err != nil {
+				return nil, err
+			}
+			resp, err := next(ctx, req)
+			b.done(key, gen, err)
+			return resp, err
+		}
+	}
+}
+
+// StreamMiddleware returns the breaker as a client
+// middleware.StreamTransportMiddleware. An open circuit fails the stream
+// before anything is sent.
+func (b *Breaker) StreamMiddleware() middleware.StreamTransportMiddleware {
+	return func(next middleware.StreamTransportHandler) middleware.StreamTransportHandler {
+		return func(ctx context.Context) error {
+			key := b.key(ctx)
+			gen, err := b.allow(key)
+			if err != nil {
+				return err
+			}
+			err = next(ctx)
+			b.done(key, gen, err)
+			return err
+		}
+	}
+}
+
+func (b *Breaker) key(ctx context.Context) string {
+	if !b.opts.perMethod {
+		return ""
+	}
+	if txp, ok := transport.FromClientContext(ctx); ok {
+		return txp.Operation()
+	}
+	return ""
+}
+
+// allow reports whether a call may go ahead, and moves an open circuit
+// to half-open once its timeout has passed. It returns the circuit's
+// generation for done.
+func (b *Breaker) allow(key string) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuit(key)
+	switch c.state {
+	case open:
+		if b.now().Sub(c.openedAt) < b.opts.openTimeout {
+			return 0, errOpen(key)
+		}
+		c.set(halfOpen)
+		c.probing = false
+		fallthrough
+	case halfOpen:
+		// 半开状态同一时间只放行一个探测请求
+		if c.probing {
+			return 0, errOpen(key)
+		}
+		c.probing = true
+	}
+	return c.generation, nil
+}
+
+// done records the result of a call that allow let through in
+// generation gen. Results from an earlier generation are ignored.
+func (b *Breaker) done(key string, gen uint64, err error) {
+	failed := err != nil && slices.Contains(b.opts.codes, status.Code(err))
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuit(key)
+	if gen != c.generation {
+		return
+	}
+	now := b.now()
+	switch c.state {
+	case halfOpen:
+		c.probing = false
+		if failed {
+			c.set(open)
+			c.openedAt = now
+			return
+		}
+		c.set(closed)
+		c.windowStart = now
+		c.requests, c.failures = 0, 0
+	case closed:
+		if now.Sub(c.windowStart) >= b.opts.window {
+			c.windowStart = now
+			c.requests, c.failures = 0, 0
+		}
+		c.requests++
+		if failed {
+			c.failures++
+		}
+		if c.requests >= b.opts.minRequests && float64(c.failures) >= b.opts.failureRatio*float64(c.requests) {
+			c.set(open)
+			c.openedAt = now
+		}
+	}
+}
+
+func (c *circuit) set(s state) {
+	c.state = s
+	c.generation++
+}
+
+func (b *Breaker) circuit(key string) *circuit {
+	c, ok := b.circuits[key]
+	if !ok {
+		c = &circuit{windowStart: b.now()}
+		b.circuits[key] = c
+	}
+	return c
+}
+
+func errOpen(key string) error {
+	md := map[string]string{}
+	if key != "" {
+		md["method"] = key
+	}
+	st, _ := status.New(codes.Unavailable, "circuit breaker is open").WithDetails(&errdetails.ErrorInfo{
+		Reason:   ReasonCircuitOpen,
+		Domain:   wire.ErrorDomain,
+		Metadata: md,
+	})
+	return st.Err()
+}
@@ -0,0 +1,136 @@
+package breaker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lisoboss/grpchub/grpchub-go-contrib/internal/transporttest"
+	"github.com/lisoboss/grpchub/grpchub-go-contrib/internal/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newTestBreaker(opts ...Option) (*Breaker, *transporttest.Clock) {
+	b := New(opts...)
+	clock := transporttest.NewClock()
+	b.now = clock.Now
+	return b, clock
+}
+
+func assertOpen(t *testing.T, err error) {
+	t.Helper()
+	st := status.Convert(err)
+	require.Equal(t, codes.Unavailable, st.Code())
+	require.Len(t, st.Details(), 1)
+	info, ok := st.Details()[0].(*errdetails.ErrorInfo)
+	require.True(t, ok)
+	assert.Equal(t, ReasonCircuitOpen, info.GetReason())
+	assert.Equal(t, wire.ErrorDomain, info.GetDomain())
+}
+
+func TestBreaker(t *testing.T) {
+	b, clock := newTestBreaker(WithMinRequests(4), WithOpenTimeout(time.Second))
+	ctx := context.Background()
+	unavailable := status.Error(codes.Unavailable, "target service is offline or not available")
+
+	// 业务错误不计为失败
+	for range 4 {
+		require.Error(t, transporttest.Call(b.Middleware(), ctx, status.Error(codes.NotFound, "no such user")))
+	}
+	require.NoError(t, transporttest.Call(b.Middleware(), ctx, nil))
+
+	// 失败比例达到阈值后熔断，请求直接失败
+	clock.Advance(10 * time.Second)
+	for range 2 {
+		require.NoError(t, transporttest.Call(b.Middleware(), ctx, nil))
+		require.ErrorIs(t, transporttest.Call(b.Middleware(), ctx, unavailable), unavailable)
+	}
+	assertOpen(t, transporttest.Call(b.Middleware(), ctx, nil))
+
+	// 超时后放行一个探测请求，失败则重新熔断
+	clock.Advance(time.Second)
+	require.Error(t, transporttest.Call(b.Middleware(), ctx, status.Error(codes.DeadlineExceeded, "timeout")))
+	assertOpen(t, transporttest.Call(b.Middleware(), ctx, nil))
+
+	// 探测成功则恢复
+	clock.Advance(time.Second)
+	require.NoError(t, transporttest.Call(b.Middleware(), ctx, nil))
+	require.NoError(t, transporttest.Call(b.Middleware(), ctx, nil))
+}
+
+func TestBreaker_HalfOpenSingleProbe(t *testing.T) {
+	b, clock := newTestBreaker(WithMinRequests(1), WithOpenTimeout(time.Second))
+	ctx := context.Background()
+
+	require.Error(t, transporttest.Call(b.Middleware(), ctx, status.Error(codes.Unavailable, "down")))
+	clock.Advance(time.Second)
+
+	// 探测请求未完成时，其他请求仍被拒绝
+	probing := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		_, err := b.Middleware()(func(context.Context, any) (any, error) {
+			close(probing)
+			<-release
+			return nil, nil
+		})(ctx, nil)
+		done <- err
+	}()
+	<-probing
+	assertOpen(t, transporttest.Call(b.Middleware(), ctx, nil))
+	close(release)
+	require.NoError(t, <-done)
+	require.NoError(t, transporttest.Call(b.Middleware(), ctx, nil))
+}
+
+func TestBreaker_StaleResult(t *testing.T) {
+	b, clock := newTestBreaker(WithMinRequests(2), WithOpenTimeout(time.Second))
+	ctx := context.Background()
+	unavailable := status.Error(codes.Unavailable, "down")
+
+	// 闭合时放行的慢请求在熔断、半开之后才完成
+	slow, err := b.allow("")
+	require.NoError(t, err)
+	for range 2 {
+		require.Error(t, transporttest.Call(b.Middleware(), ctx, unavailable))
+	}
+	clock.Advance(time.Second)
+	probe, err := b.allow("")
+	require.NoError(t, err)
+
+	// 慢请求的结果不能当作探测结果
+	b.done("", slow, nil)
+	assertOpen(t, transporttest.Call(b.Middleware(), ctx, nil))
+	b.done("", probe, unavailable)
+	assertOpen(t, transporttest.Call(b.Middleware(), ctx, nil))
+}
+
+func TestBreaker_PerMethod(t *testing.T) {
+	b, _ := newTestBreaker(WithMinRequests(1), WithPerMethod())
+	unary := transporttest.ClientContext("/test.v1.TestService/UnaryCall")
+	empty := transporttest.ClientContext("/test.v1.TestService/EmptyCall")
+
+	require.Error(t, transporttest.Call(b.Middleware(), unary, status.Error(codes.Unavailable, "down")))
+	assertOpen(t, transporttest.Call(b.Middleware(), unary, nil))
+	require.NoError(t, transporttest.Call(b.Middleware(), empty, nil))
+}
+
+func TestBreaker_Stream(t *testing.T) {
+	b, _ := newTestBreaker(WithMinRequests(1))
+	sent := false
+	stream := b.StreamMiddleware()(func(context.Context) error {
+		sent = true
+		return status.Error(codes.Unavailable, "down")
+	})
+
+	require.Error(t, stream(context.Background()))
+	sent = false
+	err := stream(context.Background())
+	assertOpen(t, err)
+	assert.False(t, sent)
+}
@@ -0,0 +1,502 @@
+// Package certs issues the TLS material GrpcHub uses, following the rules of
+// scripts/gen-certs-standalone.sh: a self-signed CA, a server certificate
+// with DNS and IP SANs, client certificates for clientAuth, and the combined
+// server.pem/client.pem files (certificate, private key, CA) the hub and
+// the SDK load.
+//
+// Tests can mint ephemeral mTLS material without openssl:
+//
+//	ca, _ := certs.NewCA(certs.WithECDSAKey())
+//	srv, _ := ca.IssueServer(certs.DefaultHosts)
+//	cli, _ := ca.IssueComponent("echo-client", time.Hour)
+package certs
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// CAValidity is the lifetime of a CA created by NewCA (openssl -days 3650).
+	CAValidity = 3650 * 24 * time.Hour
+	// Validity is the lifetime of server and client certificates (-days 365).
+	Validity = 365 * 24 * time.Hour
+
+	// clockSkew backdates NotBefore so freshly issued certificates are
+	// accepted by peers whose clocks run slightly behind.
+	clockSkew = time.Minute
+)
+
+// DefaultHosts are the server SANs gen-certs-standalone.sh uses when no
+// domain or IP is given.
+var DefaultHosts = []string{
+	"localhost", "*.localhost",
+	"grpchub-server", "*.grpchub-server",
+	"127.0.0.1", "::1", "0.0.0.0",
+}
+
+// domainPattern is the domain check of gen-certs-standalone.sh.
+var domainPattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])?)*$`)
+
+// Hosts returns the server SANs for a custom domain and/or IP the way
+// gen-certs-standalone.sh does: the domain and its wildcard plus the IP,
+// or DefaultHosts when both are empty. Like the script it rejects a
+// malformed domain, and an ip that is not an IPv4 or IPv6 address, rather
+// than letting it end up as a DNS SAN.
+func Hosts(domain, ip string) ([]string, error) {
+	if domain == "" && ip == "" {
+		return DefaultHosts, nil
+	}
+	var hosts []string
+	if domain != "" {
+		if !domainPattern.MatchString(domain) {
+			return nil, fmt.Errorf("invalid domain name: %s", domain)
+		}
+		hosts = append(hosts, domain, "*."+domain)
+	}
+	if ip != "" {
+		if net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("invalid IP address: %s", ip)
+		}
+		hosts = append(hosts, ip)
+	}
+	return hosts, nil
+}
+
+// DefaultSubject is the subject of every certificate apart from its CN.
+var DefaultSubject = pkix.Name{
+	Country:            []string{"US"},
+	Province:           []string{"CA"},
+	Locality:           []string{"San Francisco"},
+	Organization:       []string{"GrpcHub"},
+	OrganizationalUnit: []string{"IT Department"},
+}
+
+// Option configures a certificate and its key.
+type Option func(*options)
+
+type options struct {
+	validity time.Duration
+	subject  pkix.Name
+	newKey   func() (crypto.Signer, error)
+}
+
+// WithValidity sets how long the certificate is valid.
+func WithValidity(d time.Duration) Option {
+	return func(o *options) {
+		o.validity = d
+	}
+}
+
+// WithSubject replaces DefaultSubject. Its CommonName is ignored.
+func WithSubject(subject pkix.Name) Option {
+	return func(o *options) {
+		o.subject = subject
+	}
+}
+
+// WithRSAKey generates an RSA key of the given size. The default is 4096
+// bits for a CA and 2048 bits otherwise.
+func WithRSAKey(bits int) Option {
+	return func(o *options) {
+		o.newKey = func() (crypto.Signer, error) {
+			return rsa.GenerateKey(rand.Reader, bits)
+		}
+	}
+}
+
+// WithECDSAKey generates a P-256 key, which is much faster than RSA.
+func WithECDSAKey() Option {
+	return func(o *options) {
+		o.newKey = func() (crypto.Signer, error) {
+			return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		}
+	}
+}
+
+func newOptions(validity time.Duration, bits int, opts []Option) *options {
+	o := &options{validity: validity, subject: DefaultSubject}
+	WithRSAKey(bits)(o)
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Certificate is an issued certificate, its private key and its issuer.
+type Certificate struct {
+	Cert   *x509.Certificate
+	Key    crypto.Signer
+	Issuer *x509.Certificate
+}
+
+// CertPEM returns the certificate as a CERTIFICATE block.
+func (c *Certificate) CertPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Cert.Raw})
+}
+
+// KeyPEM returns the private key as a PKCS#8 PRIVATE KEY block.
+func (c *Certificate) KeyPEM() ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(c.Key)
+	if err != nil {
+		return nil, fmt.Errorf("marshal private key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// PEM returns the combined layout of server.pem and client.pem: the
+// certificate, its private key, then the CA certificate.
+func (c *Certificate) PEM() ([]byte, error) {
+	key, err := c.KeyPEM()
+	if err != nil {
+		return nil, err
+	}
+	out := append(c.CertPEM(), key...)
+	return append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Issuer.Raw})...), nil
+}
+
+// TLSCertificate returns the certificate and key for tls.Config.Certificates.
+func (c *Certificate) TLSCertificate() tls.Certificate {
+	return tls.Certificate{
+		Certificate: [][]byte{c.Cert.Raw},
+		PrivateKey:  c.Key,
+		Leaf:        c.Cert,
+	}
+}
+
+// CA is a self-signed certificate authority.
+type CA struct {
+	Certificate
+}
+
+// NewCA creates a self-signed CA valid for CAValidity.
+func NewCA(opts ...Option) (*CA, error) {
+	o := newOptions(CAValidity, 4096, opts)
+	key, err := o.newKey()
+	if err != nil {
+		return nil, fmt.Errorf("generate CA key: %w", err)
+	}
+
+	tmpl, err := newTemplate(o, "GrpcHub CA")
+	if err != nil {
+		return nil, err
+	}
+	tmpl.IsCA = true
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+
+	cert, err := createCertificate(tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	return &CA{Certificate{Cert: cert, Key: key, Issuer: cert}}, nil
+}
+
+// LoadCA reads a CA from its certificate and private key PEM, e.g. the
+// ca.crt and ca.key written by WriteFiles or gen-certs.sh.
+func LoadCA(certPEM, keyPEM []byte) (*CA, error) {
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("load CA: %w", err)
+	}
+	if !pair.Leaf.IsCA {
+		return nil, errors.New("load CA: certificate is not a CA")
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("load CA: unsupported private key type %T", pair.PrivateKey)
+	}
+	return &CA{Certificate{Cert: pair.Leaf, Key: key, Issuer: pair.Leaf}}, nil
+}
+
+// LoadCAFiles reads ca.crt and ca.key from dir.
+func LoadCAFiles(dir string) (*CA, error) {
+	certPEM, err := os.ReadFile(filepath.Join(dir, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := os.ReadFile(filepath.Join(dir, "ca.key"))
+	if err != nil {
+		return nil, err
+	}
+	return LoadCA(certPEM, keyPEM)
+}
+
+// LoadKeyPair reads a combined PEM file such as server.pem or client.pem.
+// See ParseKeyPair.
+func LoadKeyPair(path string) (tls.Certificate, *x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	cert, roots, err := ParseKeyPair(data)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cert, roots, nil
+}
+
+// ParseKeyPair splits combined PEM data into the certificate to present
+// and the CAs that verify the peer, in whatever order the blocks come.
+// The certificate whose public key matches the private key is the leaf
+// and the certificates that issue it follow it in the chain; only the
+// remaining certificates become roots.
+func ParseKeyPair(data []byte) (tls.Certificate, *x509.CertPool, error) {
+	var key crypto.Signer
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return tls.Certificate{}, nil, err
+			}
+			certs = append(certs, cert)
+		case "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY":
+			if key != nil {
+				return tls.Certificate{}, nil, errors.New("more than one private key")
+			}
+			k, err := parsePrivateKey(block)
+			if err != nil {
+				return tls.Certificate{}, nil, err
+			}
+			key = k
+		}
+	}
+	if key == nil {
+		return tls.Certificate{}, nil, errors.New("no private key found")
+	}
+
+	pub, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return tls.Certificate{}, nil, fmt.Errorf("unsupported public key type %T", key.Public())
+	}
+	i := slices.IndexFunc(certs, func(c *x509.Certificate) bool {
+		return pub.Equal(c.PublicKey)
+	})
+	if i < 0 {
+		return tls.Certificate{}, nil, errors.New("no certificate matches the private key")
+	}
+	leaf := certs[i]
+	rest := slices.Delete(slices.Clone(certs), i, i+1)
+
+	pair := tls.Certificate{Certificate: [][]byte{leaf.Raw}, PrivateKey: key, Leaf: leaf}
+	for last := leaf; !isSelfSigned(last); {
+		j := slices.IndexFunc(rest, func(c *x509.Certificate) bool {
+			return !isSelfSigned(c) && last.CheckSignatureFrom(c) == nil
+		})
+		if j < 0 {
+			break
+		}
+		last = rest[j]
+		pair.Certificate = append(pair.Certificate, last.Raw)
+		rest = slices.Delete(rest, j, j+1)
+	}
+	if len(rest) == 0 {
+		return tls.Certificate{}, nil, errors.New("no CA certificate found besides the certificate chain")
+	}
+
+	roots := x509.NewCertPool()
+	for _, c := range rest {
+		roots.AddCert(c)
+	}
+	return pair, roots, nil
+}
+
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	var key any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+func isSelfSigned(c *x509.Certificate) bool {
+	return bytes.Equal(c.RawIssuer, c.RawSubject) && c.CheckSignatureFrom(c) == nil
+}
+
+// IssueServer issues a server certificate. Each host is added as an IP SAN
+// if it parses as an IP address and as a DNS SAN otherwise. The CN is the
+// first non-wildcard DNS name, or grpchub-server if there is none.
+func (ca *CA) IssueServer(hosts []string, opts ...Option) (*Certificate, error) {
+	if len(hosts) == 0 {
+		return nil, errors.New("server certificate needs at least one host")
+	}
+	var dnsNames []string
+	var ips []net.IP
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			ips = append(ips, ip)
+		} else {
+			dnsNames = append(dnsNames, h)
+		}
+	}
+	cn := "grpchub-server"
+	for _, n := range dnsNames {
+		if !strings.HasPrefix(n, "*.") {
+			cn = n
+			break
+		}
+	}
+
+	return ca.issue(cn, opts, func(tmpl *x509.Certificate) {
+		tmpl.DNSNames = dnsNames
+		tmpl.IPAddresses = ips
+	})
+}
+
+// IssueClient issues a client certificate with the given CN.
+func (ca *CA) IssueClient(cn string, opts ...Option) (*Certificate, error) {
+	return ca.issue(cn, opts, func(tmpl *x509.Certificate) {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	})
+}
+
+// IssueComponent issues a short-lived client certificate for componentID
+// with a P-256 key. The ID is the CN, so hub.VerifyPeerCertificate accepts
+// the certificate for that component.
+func (ca *CA) IssueComponent(componentID string, ttl time.Duration) (*Certificate, error) {
+	return ca.IssueClient(componentID, WithValidity(ttl), WithECDSAKey())
+}
+
+func (ca *CA) issue(cn string, opts []Option, extend func(*x509.Certificate)) (*Certificate, error) {
+	o := newOptions(Validity, 2048, opts)
+	key, err := o.newKey()
+	if err != nil {
+		return nil, fmt.Errorf("generate key for %s: %w", cn, err)
+	}
+
+	tmpl, err := newTemplate(o, cn)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.KeyUsage = x509.KeyUsageContentCommitment | x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	extend(tmpl)
+
+	cert, err := createCertificate(tmpl, ca.Cert, key.Public(), ca.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &Certificate{Cert: cert, Key: key, Issuer: ca.Cert}, nil
+}
+
+func newTemplate(o *options, cn string) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("generate serial number: %w", err)
+	}
+	subject := o.subject
+	subject.CommonName = cn
+
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               subject,
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              now.Add(o.validity),
+		BasicConstraintsValid: true,
+	}, nil
+}
+
+func createCertificate(tmpl, parent *x509.Certificate, pub crypto.PublicKey, signer crypto.Signer) (*x509.Certificate, error) {
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, signer)
+	if err != nil {
+		return nil, fmt.Errorf("create certificate %s: %w", tmpl.Subject.CommonName, err)
+	}
+	return x509.ParseCertificate(der)
+}
+
+// WriteFiles creates a CA, a server certificate for hosts and a client
+// certificate, and writes them to dir with the names gen-certs.sh uses:
+// ca.crt, ca.key, server.crt, server.key, server.pem, client.crt,
+// client.key and client.pem. opts apply to all three certificates.
+func WriteFiles(dir string, hosts []string, opts ...Option) error {
+	ca, err := NewCA(opts...)
+	if err != nil {
+		return err
+	}
+	server, err := ca.IssueServer(hosts, opts...)
+	if err != nil {
+		return err
+	}
+	client, err := ca.IssueClient("grpchub-client", opts...)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := writeCertificate(dir, "ca", &ca.Certificate, false); err != nil {
+		return err
+	}
+	if err := writeCertificate(dir, "server", server, true); err != nil {
+		return err
+	}
+	return writeCertificate(dir, "client", client, true)
+}
+
+// WriteComponentPEM issues a component certificate from ca and writes its
+// combined PEM to path.
+func WriteComponentPEM(ca *CA, componentID string, ttl time.Duration, path string) error {
+	c, err := ca.IssueComponent(componentID, ttl)
+	if err != nil {
+		return err
+	}
+	data, err := c.PEM()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+func writeCertificate(dir, name string, c *Certificate, combined bool) error {
+	key, err := c.KeyPEM()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".crt"), c.CertPEM(), 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".key"), key, 0o600); err != nil {
+		return err
+	}
+	if !combined {
+		return nil
+	}
+	data, err := c.PEM()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, name+".pem"), data, 0o600)
+}
@@ -0,0 +1,169 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCA_Issue(t *testing.T) {
+	ca, err := NewCA(WithECDSAKey())
+	require.NoError(t, err)
+	assert.True(t, ca.Cert.IsCA)
+	assert.Equal(t, "GrpcHub CA", ca.Cert.Subject.CommonName)
+	assert.NotEmpty(t, ca.Cert.SubjectKeyId)
+
+	server, err := ca.IssueServer(DefaultHosts, WithECDSAKey())
+	require.NoError(t, err)
+	assert.Equal(t, "localhost", server.Cert.Subject.CommonName)
+	assert.Equal(t, []string{"localhost", "*.localhost", "grpchub-server", "*.grpchub-server"}, server.Cert.DNSNames)
+	assert.Len(t, server.Cert.IPAddresses, 3)
+	assert.False(t, server.Cert.IsCA)
+	assert.Equal(t, ca.Cert.SubjectKeyId, server.Cert.AuthorityKeyId)
+
+	client, err := ca.IssueComponent("echo-client", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, "echo-client", client.Cert.Subject.CommonName)
+	assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, client.Cert.ExtKeyUsage)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), client.Cert.NotAfter, time.Minute)
+
+	// 用签发的证书完成一次双向 TLS 握手
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Cert)
+	sc, cc := net.Pipe()
+	defer sc.Close()
+	defer cc.Close()
+
+	srv := tls.Server(sc, &tls.Config{
+		Certificates: []tls.Certificate{server.TLSCertificate()},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	cli := tls.Client(cc, &tls.Config{
+		Certificates: []tls.Certificate{client.TLSCertificate()},
+		RootCAs:      pool,
+		ServerName:   "localhost",
+	})
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.Handshake()
+	}()
+	require.NoError(t, cli.Handshake())
+	require.NoError(t, <-errs)
+	assert.Equal(t, "echo-client", srv.ConnectionState().PeerCertificates[0].Subject.CommonName)
+}
+
+func TestHosts(t *testing.T) {
+	for _, tt := range []struct {
+		domain, ip string
+		want       []string
+	}{
+		{"", "", DefaultHosts},
+		{"example.com", "", []string{"example.com", "*.example.com"}},
+		{"example.com", "192.168.1.100", []string{"example.com", "*.example.com", "192.168.1.100"}},
+		{"", "fd00::1", []string{"fd00::1"}},
+	} {
+		hosts, err := Hosts(tt.domain, tt.ip)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, hosts)
+	}
+
+	for _, tt := range []struct{ domain, ip string }{
+		{"-example.com", ""},
+		{"example..com", ""},
+		{"*.example.com", ""},
+		{"", "not-an-ip"},
+		{"", "256.1.1.1"},
+		{"example.com", "example.com"},
+	} {
+		_, err := Hosts(tt.domain, tt.ip)
+		assert.Error(t, err, "domain %q ip %q", tt.domain, tt.ip)
+	}
+
+	hosts, err := Hosts("", "192.168.1.100")
+	require.NoError(t, err)
+	ca, err := NewCA(WithECDSAKey())
+	require.NoError(t, err)
+	server, err := ca.IssueServer(hosts, WithECDSAKey())
+	require.NoError(t, err)
+	assert.Equal(t, "grpchub-server", server.Cert.Subject.CommonName)
+	assert.Empty(t, server.Cert.DNSNames)
+}
+
+func TestWriteFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, WriteFiles(dir, DefaultHosts, WithECDSAKey()))
+
+	for _, name := range []string{"server", "client"} {
+		data, err := os.ReadFile(filepath.Join(dir, name+".pem"))
+		require.NoError(t, err)
+		// 合并文件可以直接作为证书和私钥加载
+		_, err = tls.X509KeyPair(data, data)
+		require.NoError(t, err, name)
+	}
+
+	ca, err := LoadCAFiles(dir)
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "echo-server.pem")
+	require.NoError(t, WriteComponentPEM(ca, "echo-server", time.Hour, path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	pair, err := tls.X509KeyPair(data, data)
+	require.NoError(t, err)
+	assert.Equal(t, "echo-server", pair.Leaf.Subject.CommonName)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Cert)
+	_, err = pair.Leaf.Verify(x509.VerifyOptions{
+		Roots:     pool,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	assert.NoError(t, err)
+}
+
+func TestParseKeyPair(t *testing.T) {
+	root, err := NewCA(WithECDSAKey())
+	require.NoError(t, err)
+	c, err := root.issue("GrpcHub Intermediate", []Option{WithECDSAKey()}, func(tmpl *x509.Certificate) {
+		tmpl.IsCA = true
+		tmpl.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign
+	})
+	require.NoError(t, err)
+	intermediate := &CA{*c}
+	client, err := intermediate.IssueComponent("echo-client", time.Hour)
+	require.NoError(t, err)
+
+	// 根证书在前、叶子证书在后，私钥夹在中间
+	key, err := client.KeyPEM()
+	require.NoError(t, err)
+	var data []byte
+	data = append(data, root.CertPEM()...)
+	data = append(data, key...)
+	data = append(data, intermediate.CertPEM()...)
+	data = append(data, client.CertPEM()...)
+
+	pair, roots, err := ParseKeyPair(data)
+	require.NoError(t, err)
+	assert.Equal(t, "echo-client", pair.Leaf.Subject.CommonName)
+	assert.Equal(t, [][]byte{client.Cert.Raw, intermediate.Cert.Raw}, pair.Certificate)
+	want := x509.NewCertPool()
+	want.AddCert(root.Cert)
+	assert.True(t, roots.Equal(want), "only the root CA is trusted")
+
+	_, _, err = ParseKeyPair(append(key, client.CertPEM()...))
+	assert.ErrorContains(t, err, "no CA certificate")
+
+	other, err := root.IssueComponent("echo-server", time.Hour)
+	require.NoError(t, err)
+	_, _, err = ParseKeyPair(append(key, other.CertPEM()...))
+	assert.ErrorContains(t, err, "no certificate matches")
+}
@@ -0,0 +1,126 @@
+// Package interceptor runs gRPC unary interceptors as grpcx middleware, so
+// the interceptor chain of a plain gRPC server or client, such as the
+// go-grpc-middleware logging, auth and recovery interceptors, also works
+// for calls routed through the hub:
+//
+//	srv, _ := grpcx.NewServer("echo-server", ghc,
+//		grpcx.Middleware(interceptor.UnaryServer(
+//			logging.UnaryServerInterceptor(logger),
+//			recovery.UnaryServerInterceptor(),
+//		)),
+//	)
+//
+// Stream interceptors are not covered: they wrap a grpc.ServerStream or
+// grpc.ClientStream, which grpcx does not hand to its stream middleware.
+package interceptor
+
+import (
+	"context"
+
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/lisoboss/grpchub-go/middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// UnaryServer chains interceptors into a server middleware.Middleware.
+// The first interceptor is the outermost, as with
+// grpc.ChainUnaryInterceptor.
+//
+// Each interceptor gets a grpc.UnaryServerInfo whose FullMethod is the
+// call's operation; its Server is nil. If ctx carries no incoming gRPC
+// metadata, the request header is added as such, so interceptors that read
+// metadata.FromIncomingContext see the caller's PT_HEADER metadata.
+func UnaryServer(interceptors ...grpc.UnaryServerInterceptor) middleware.Middleware {
+	chained := chainUnaryServer(interceptors)
+	return func(next middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (any, error) {
+			info := &grpc.UnaryServerInfo{}
+			if txp, ok := transport.FromServerContext(ctx); ok {
+				info.FullMethod = txp.Operation()
+				if _, ok := metadata.FromIncomingContext(ctx); !ok {
+					ctx = metadata.NewIncomingContext(ctx, toMetadata(txp.RequestHeader()))
+				}
+			}
+			return chained(ctx, req, info, grpc.UnaryHandler(next))
+		}
+	}
+}
+
+func chainUnaryServer(interceptors []grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			next, interceptor := handler, interceptors[i]
+			handler = func(ctx context.Context, req any) (any, error) {
+				return interceptor(ctx, req, info, next)
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// UnaryClient chains interceptors into a client middleware.Middleware.
+// The first interceptor is the outermost, as with
+// grpc.WithChainUnaryInterceptor.
+//
+// Each interceptor gets the call's operation as its method and a nil
+// reply and ClientConn; the response comes back from the middleware, not
+// through reply. CallOptions passed to the invoker are ignored. Outgoing
+// gRPC metadata the interceptors add is copied into the request header
+// for keys the header does not have yet, so it reaches the server in
+// PT_HEADER.
+func UnaryClient(interceptors ...grpc.UnaryClientInterceptor) middleware.Middleware {
+	return func(next middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (any, error) {
+			var method string
+			if txp, ok := transport.FromClientContext(ctx); ok {
+				method = txp.Operation()
+			}
+
+			var resp any
+			invoker := func(ctx context.Context, _ string, req, _ any, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+				if txp, ok := transport.FromClientContext(ctx); ok {
+					if md, ok := metadata.FromOutgoingContext(ctx); ok {
+						addMissing(txp.RequestHeader(), md)
+					}
+				}
+				var err error
+				resp, err = next(ctx, req)
+				return err
+			}
+			for i := len(interceptors) - 1; i >= 0; i-- {
+				next, interceptor := invoker, interceptors[i]
+				invoker = func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+					return interceptor(ctx, method, req, reply, cc, next, opts...)
+				}
+			}
+			err := invoker(ctx, method, req, nil, nil)
+			return resp, err
+		}
+	}
+}
+
+func toMetadata(h transport.Header) metadata.MD {
+	md := metadata.MD{}
+	if h == nil {
+		return md
+	}
+	for _, k := range h.Keys() {
+		md.Append(k, h.Values(k)...)
+	}
+	return md
+}
+
+func addMissing(h transport.Header, md metadata.MD) {
+	if h == nil {
+		return
+	}
+	for k, vs := range md {
+		if len(h.Values(k)) > 0 {
+			continue
+		}
+		for _, v := range vs {
+			h.Add(k, v)
+		}
+	}
+}
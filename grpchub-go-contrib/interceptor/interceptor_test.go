@@ -0,0 +1,82 @@
+package interceptor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/lisoboss/grpchub/grpchub-go-contrib/internal/transporttest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServer(t *testing.T) {
+	var order []string
+	trace := func(name string) grpc.UnaryServerInterceptor {
+		return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			order = append(order, name+" "+info.FullMethod)
+			return handler(ctx, req)
+		}
+	}
+	// 与 go-grpc-middleware 的 auth 拦截器一样从 incoming metadata 读取令牌
+	auth := func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if got := md.Get("authorization"); len(got) != 1 || got[0] != "bearer token" {
+			return nil, status.Error(codes.Unauthenticated, "bad token")
+		}
+		return handler(ctx, req)
+	}
+	m := UnaryServer(trace("outer"), trace("inner"), auth)
+	handler := m(func(_ context.Context, req any) (any, error) {
+		return req.(string) + " handled", nil
+	})
+
+	ctx := transporttest.ServerContext("/test.v1.TestService/UnaryCall", "authorization", "bearer token")
+	resp, err := handler(ctx, "req")
+	require.NoError(t, err)
+	assert.Equal(t, "req handled", resp)
+	assert.Equal(t, []string{
+		"outer /test.v1.TestService/UnaryCall",
+		"inner /test.v1.TestService/UnaryCall",
+	}, order)
+
+	_, err = handler(transporttest.ServerContext("/test.v1.TestService/UnaryCall"), "req")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestUnaryClient(t *testing.T) {
+	var method string
+	tag := func(ctx context.Context, m string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		method = m
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-request-id", "42")
+		return invoker(ctx, m, req, reply, cc, opts...)
+	}
+	fail := status.Error(codes.Unavailable, "down")
+	retryOnce := func(ctx context.Context, m string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := invoker(ctx, m, req, reply, cc, opts...); err != fail {
+			return err
+		}
+		return invoker(ctx, m, req, reply, cc, opts...)
+	}
+	m := UnaryClient(tag, retryOnce)
+
+	txp := transporttest.NewTransport("/test.v1.TestService/UnaryCall")
+	calls := 0
+	resp, err := m(func(_ context.Context, req any) (any, error) {
+		calls++
+		if calls == 1 {
+			return nil, fail
+		}
+		return req.(string) + " sent", nil
+	})(transport.NewClientContext(context.Background(), txp), "req")
+
+	require.NoError(t, err)
+	assert.Equal(t, "req sent", resp)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, "/test.v1.TestService/UnaryCall", method)
+	assert.Equal(t, []string{"42"}, txp.RequestHeader().Values("x-request-id"))
+}
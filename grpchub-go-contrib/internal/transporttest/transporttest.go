@@ -0,0 +1,90 @@
+// Package transporttest provides the fake Kratos transport, clock and
+// call helpers that the contrib middleware tests share.
+package transporttest
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/lisoboss/grpchub-go/middleware"
+)
+
+// Header is a transport.Header backed by a map.
+type Header map[string][]string
+
+func (h Header) Get(key string) string {
+	if v := h[key]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (h Header) Set(key, value string) { h[key] = []string{value} }
+func (h Header) Add(key, value string) { h[key] = append(h[key], value) }
+
+func (h Header) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (h Header) Values(key string) []string { return h[key] }
+
+// Transport is a transport.Transporter for a call of Method to the
+// echo-server component.
+type Transport struct {
+	Method  string
+	Request Header
+	Reply   Header
+}
+
+func (t *Transport) Kind() transport.Kind            { return transport.KindGRPC }
+func (t *Transport) Endpoint() string                { return "hub:///echo-server" }
+func (t *Transport) Operation() string               { return t.Method }
+func (t *Transport) RequestHeader() transport.Header { return t.Request }
+func (t *Transport) ReplyHeader() transport.Header   { return t.Reply }
+
+// NewTransport returns a Transport for operation with empty headers.
+func NewTransport(operation string) *Transport {
+	return &Transport{Method: operation, Request: Header{}, Reply: Header{}}
+}
+
+// ClientContext returns a client context carrying a call of operation.
+func ClientContext(operation string) context.Context {
+	return transport.NewClientContext(context.Background(), NewTransport(operation))
+}
+
+// ServerContext returns a server context for a call of operation whose
+// request header holds key/value pairs from kv.
+func ServerContext(operation string, kv ...string) context.Context {
+	t := NewTransport(operation)
+	for i := 0; i+1 < len(kv); i += 2 {
+		t.Request.Set(kv[i], kv[i+1])
+	}
+	return transport.NewServerContext(context.Background(), t)
+}
+
+// Clock is a manual clock for middleware that reads the time through a
+// now func.
+type Clock struct {
+	t time.Time
+}
+
+// NewClock returns a Clock set to the Unix epoch.
+func NewClock() *Clock {
+	return &Clock{t: time.Unix(0, 0)}
+}
+
+func (c *Clock) Now() time.Time          { return c.t }
+func (c *Clock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// Call runs m around a handler that returns err.
+func Call(m middleware.Middleware, ctx context.Context, err error) error {
+	_, got := m(func(context.Context, any) (any, error) {
+		return nil, err
+	})(ctx, nil)
+	return got
+}
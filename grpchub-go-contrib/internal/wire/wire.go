@@ -0,0 +1,14 @@
+// Package wire holds the hub's wire constants that the contrib packages
+// share. They must match grpchub-serve and the hub package of the Go
+// tests.
+package wire
+
+const (
+	// ErrorDomain is the ErrorInfo domain of errors produced by the hub and
+	// by hub-side middleware.
+	ErrorDomain = "grpchub"
+
+	// SenderIDHeader is the PT_HEADER metadata key the hub sets to the
+	// sending component's ID.
+	SenderIDHeader = "grpchub-sender-id"
+)
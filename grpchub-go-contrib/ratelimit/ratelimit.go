@@ -0,0 +1,299 @@
+// Package ratelimit caps the calls a hub-backed grpcx server accepts: how
+// many run at once, and how fast each calling component and each method
+// may start new ones. A rejected call fails with RESOURCE_EXHAUSTED and a
+// RetryInfo telling the caller when to try again:
+//
+//	l := ratelimit.New(
+//		ratelimit.WithMaxConcurrent(64),
+//		ratelimit.WithMaxConcurrentPerComponent(16),
+//		ratelimit.WithComponentRate(50, 100),
+//	)
+//	srv, _ := grpcx.NewServer("echo-server", ghc,
+//		grpcx.Middleware(l.Middleware()),
+//		grpcx.StreamTransportMiddleware(l.StreamMiddleware()),
+//	)
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/lisoboss/grpchub-go/middleware"
+	"github.com/lisoboss/grpchub/grpchub-go-contrib/internal/wire"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	// concurrencyRetryDelay is the RetryInfo delay sent when every slot is
+	// in use; how long a slot stays taken is unknown.
+	concurrencyRetryDelay = 100 * time.Millisecond
+
+	// sweepInterval is how often idle buckets are dropped.
+	sweepInterval = time.Minute
+)
+
+type rate struct {
+	perSecond float64
+	burst     int
+}
+
+// Option configures a Limiter.
+type Option func(*Limiter)
+
+// WithMaxConcurrent caps how many calls and streams run at once. It
+// panics if n is not positive.
+func WithMaxConcurrent(n int) Option {
+	if n <= 0 {
+		panic(fmt.Sprintf("ratelimit: WithMaxConcurrent(%d): n must be positive", n))
+	}
+	return func(l *Limiter) {
+		l.slots = make(chan struct{}, n)
+	}
+}
+
+// WithMaxConcurrentPerComponent caps how many calls and streams each
+// calling component runs at once, so one busy component cannot take every
+// slot of WithMaxConcurrent. Components are identified like in
+// WithComponentRate. It panics if n is not positive.
+func WithMaxConcurrentPerComponent(n int) Option {
+	if n <= 0 {
+		panic(fmt.Sprintf("ratelimit: WithMaxConcurrentPerComponent(%d): n must be positive", n))
+	}
+	return func(l *Limiter) {
+		l.perComponent = n
+	}
+}
+
+// WithComponentRate gives every calling component its own token bucket
+// that refills at perSecond and holds at most burst calls. The caller is
+// identified by the grpchub-sender-id header the hub sets on PT_HEADER;
+// calls without it share one bucket. It panics if perSecond is not
+// positive or burst is less than 1.
+func WithComponentRate(perSecond float64, burst int) Option {
+	r := newRate("WithComponentRate", perSecond, burst)
+	return func(l *Limiter) {
+		l.componentRate = r
+	}
+}
+
+// WithMethodRate gives every method its own token bucket that refills at
+// perSecond and holds at most burst calls. It panics if perSecond is not
+// positive or burst is less than 1.
+func WithMethodRate(perSecond float64, burst int) Option {
+	r := newRate("WithMethodRate", perSecond, burst)
+	return func(l *Limiter) {
+		l.methodRate = r
+	}
+}
+
+func newRate(option string, perSecond float64, burst int) *rate {
+	if !(perSecond > 0) || burst < 1 {
+		panic(fmt.Sprintf("ratelimit: %s(%v, %d): perSecond must be positive and burst at least 1", option, perSecond, burst))
+	}
+	return &rate{perSecond: perSecond, burst: burst}
+}
+
+// Limiter holds the limits of one server. Buckets that have been idle
+// long enough to refill are dropped, so callers that come and go do not
+// grow it without bound.
+type Limiter struct {
+	slots         chan struct{}
+	perComponent  int
+	componentRate *rate
+	methodRate    *rate
+	now           func() time.Time
+
+	mu         sync.Mutex
+	running    map[string]int
+	components map[string]*bucket
+	methods    map[string]*bucket
+	swept      time.Time
+}
+
+// New returns a Limiter with opts. Without options it accepts every call.
+func New(opts ...Option) *Limiter {
+	l := &Limiter{
+		now:        time.Now,
+		running:    make(map[string]int),
+		components: make(map[string]*bucket),
+		methods:    make(map[string]*bucket),
+	}
+	for _, o := range opts {
+		o(l)
+	}
+	return l
+}
+
+// Middleware returns the limits as a server middleware.Middleware.
+func (l *Limiter) Middleware() middleware.Middleware {
+	return func(next middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (any, error) {
+			release, err := l.acquire(ctx)
+			if err != nil {
+				return nil, err
+			}
+			defer release()
+			return next(ctx, req)
+		}
+	}
+}
+
+// StreamMiddleware returns the limits as a server
+// middleware.StreamTransportMiddleware. A stream holds its concurrency
+// slot until it ends.
+func (l *Limiter) StreamMiddleware() middleware.StreamTransportMiddleware {
+	return func(next middleware.StreamTransportHandler) middleware.StreamTransportHandler {
+		return func(ctx context.Context) error {
+			release, err := l.acquire(ctx)
+			if err != nil {
+				return err
+			}
+			defer release()
+			return next(ctx)
+		}
+	}
+}
+
+func (l *Limiter) acquire(ctx context.Context) (release func(), err error) {
+	var component, method string
+	if txp, ok := transport.FromServerContext(ctx); ok {
+		method = txp.Operation()
+		if h := txp.RequestHeader(); h != nil {
+			component = h.Get(wire.SenderIDHeader)
+		}
+	}
+
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			return nil, errExhausted("too many concurrent calls", concurrencyRetryDelay)
+		}
+	}
+	freeSlot := func() {
+		if l.slots != nil {
+			<-l.slots
+		}
+	}
+
+	if err := l.take(component, method); err != nil {
+		freeSlot()
+		return nil, err
+	}
+	return func() {
+		l.leave(component)
+		freeSlot()
+	}, nil
+}
+
+// take counts a running call of component and spends a token from the
+// caller's and the method's bucket. It does neither if the component
+// already runs its share of calls or either bucket is empty.
+func (l *Limiter) take(component, method string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.swept) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	if l.perComponent > 0 && l.running[component] >= l.perComponent {
+		return errExhausted(fmt.Sprintf("too many concurrent calls from component %q", component), concurrencyRetryDelay)
+	}
+
+	type limit struct {
+		b    *bucket
+		what string
+	}
+	var limits []limit
+	if l.componentRate != nil {
+		limits = append(limits, limit{l.bucket(l.components, component, l.componentRate, now), fmt.Sprintf("component %q", component)})
+	}
+	if l.methodRate != nil {
+		limits = append(limits, limit{l.bucket(l.methods, method, l.methodRate, now), fmt.Sprintf("method %q", method)})
+	}
+
+	for _, lim := range limits {
+		if wait := lim.b.wait(now); wait > 0 {
+			return errExhausted("rate limit exceeded for "+lim.what, wait)
+		}
+	}
+	for _, lim := range limits {
+		lim.b.tokens--
+	}
+	if l.perComponent > 0 {
+		l.running[component]++
+	}
+	return nil
+}
+
+// leave ends a call that take counted.
+func (l *Limiter) leave(component string) {
+	if l.perComponent == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.running[component]--; l.running[component] == 0 {
+		delete(l.running, component)
+	}
+}
+
+// sweep drops the buckets that would be full by now; a new bucket starts
+// full, so dropping them changes no limit. The caller must hold l.mu.
+func (l *Limiter) sweep(now time.Time) {
+	for _, m := range []map[string]*bucket{l.components, l.methods} {
+		for key, b := range m {
+			if b.full(now) {
+				delete(m, key)
+			}
+		}
+	}
+	l.swept = now
+}
+
+func (l *Limiter) bucket(m map[string]*bucket, key string, r *rate, now time.Time) *bucket {
+	b, ok := m[key]
+	if !ok {
+		b = &bucket{rate: r, tokens: float64(r.burst), last: now}
+		m[key] = b
+	}
+	return b
+}
+
+// bucket is a token bucket. The caller must hold Limiter.mu.
+type bucket struct {
+	rate   *rate
+	tokens float64
+	last   time.Time
+}
+
+// full reports whether the bucket will have refilled to burst by now.
+func (b *bucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate.perSecond >= float64(b.rate.burst)
+}
+
+// wait refills the bucket up to now and returns how long until it holds a
+// whole token, or 0 if it already does.
+func (b *bucket) wait(now time.Time) time.Duration {
+	b.tokens = min(float64(b.rate.burst), b.tokens+now.Sub(b.last).Seconds()*b.rate.perSecond)
+	b.last = now
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate.perSecond * float64(time.Second))
+}
+
+func errExhausted(msg string, retryAfter time.Duration) error {
+	st, _ := status.New(codes.ResourceExhausted, msg).WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(retryAfter),
+	})
+	return st.Err()
+}
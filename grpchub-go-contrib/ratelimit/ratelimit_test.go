@@ -0,0 +1,152 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lisoboss/grpchub/grpchub-go-contrib/internal/transporttest"
+	"github.com/lisoboss/grpchub/grpchub-go-contrib/internal/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func serverContext(component, method string) context.Context {
+	return transporttest.ServerContext(method, wire.SenderIDHeader, component)
+}
+
+func newTestLimiter(opts ...Option) (*Limiter, *transporttest.Clock) {
+	l := New(opts...)
+	clock := transporttest.NewClock()
+	l.now = clock.Now
+	return l, clock
+}
+
+// assertExhausted checks the rejection and returns its RetryInfo delay.
+func assertExhausted(t *testing.T, err error) time.Duration {
+	t.Helper()
+	st := status.Convert(err)
+	require.Equal(t, codes.ResourceExhausted, st.Code(), err)
+	require.Len(t, st.Details(), 1)
+	info, ok := st.Details()[0].(*errdetails.RetryInfo)
+	require.True(t, ok)
+	return info.GetRetryDelay().AsDuration()
+}
+
+func TestLimiter_ComponentRate(t *testing.T) {
+	l, clock := newTestLimiter(WithComponentRate(2, 2))
+	noisy := serverContext("noisy-client", "/test.v1.TestService/EmptyCall")
+	quiet := serverContext("quiet-client", "/test.v1.TestService/EmptyCall")
+
+	require.NoError(t, transporttest.Call(l.Middleware(), noisy, nil))
+	require.NoError(t, transporttest.Call(l.Middleware(), noisy, nil))
+	err := transporttest.Call(l.Middleware(), noisy, nil)
+	assert.Equal(t, 500*time.Millisecond, assertExhausted(t, err))
+	assert.Contains(t, status.Convert(err).Message(), `"noisy-client"`)
+
+	// 其他组件不受影响
+	require.NoError(t, transporttest.Call(l.Middleware(), quiet, nil))
+
+	clock.Advance(500 * time.Millisecond)
+	require.NoError(t, transporttest.Call(l.Middleware(), noisy, nil))
+	assertExhausted(t, transporttest.Call(l.Middleware(), noisy, nil))
+}
+
+func TestLimiter_MethodRate(t *testing.T) {
+	l, _ := newTestLimiter(WithComponentRate(10, 10), WithMethodRate(1, 1))
+	ctx := serverContext("echo-client", "/test.v1.TestService/UnaryCall")
+
+	require.NoError(t, transporttest.Call(l.Middleware(), ctx, nil))
+	err := transporttest.Call(l.Middleware(), ctx, nil)
+	assertExhausted(t, err)
+	assert.Contains(t, status.Convert(err).Message(), "UnaryCall")
+	require.NoError(t, transporttest.Call(l.Middleware(), serverContext("echo-client", "/test.v1.TestService/EmptyCall"), nil))
+
+	// 被拒绝的调用不消耗组件的额度
+	assert.InDelta(t, 8, l.components["echo-client"].tokens, 0.001)
+}
+
+func TestLimiter_MaxConcurrent(t *testing.T) {
+	l, _ := newTestLimiter(WithMaxConcurrent(1))
+	ctx := serverContext("echo-client", "/test.v1.TestService/BidirectionalStream")
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- l.StreamMiddleware()(func(context.Context) error {
+			close(started)
+			<-release
+			return nil
+		})(ctx)
+	}()
+	<-started
+
+	assert.Equal(t, concurrencyRetryDelay, assertExhausted(t, transporttest.Call(l.Middleware(), ctx, nil)))
+	close(release)
+	require.NoError(t, <-done)
+	require.NoError(t, transporttest.Call(l.Middleware(), ctx, nil))
+}
+
+func TestLimiter_MaxConcurrentPerComponent(t *testing.T) {
+	l, _ := newTestLimiter(WithMaxConcurrent(4), WithMaxConcurrentPerComponent(1))
+	noisy := serverContext("noisy-client", "/test.v1.TestService/BidirectionalStream")
+	quiet := serverContext("quiet-client", "/test.v1.TestService/EmptyCall")
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- l.StreamMiddleware()(func(context.Context) error {
+			close(started)
+			<-release
+			return nil
+		})(noisy)
+	}()
+	<-started
+
+	// 一个组件占满自己的份额后，其他组件仍可调用
+	err := transporttest.Call(l.Middleware(), noisy, nil)
+	assert.Equal(t, concurrencyRetryDelay, assertExhausted(t, err))
+	assert.Contains(t, status.Convert(err).Message(), `"noisy-client"`)
+	require.NoError(t, transporttest.Call(l.Middleware(), quiet, nil))
+
+	close(release)
+	require.NoError(t, <-done)
+	require.NoError(t, transporttest.Call(l.Middleware(), noisy, nil))
+	assert.Empty(t, l.running)
+}
+
+func TestLimiter_SweepIdleBuckets(t *testing.T) {
+	l, clock := newTestLimiter(WithComponentRate(1, 2), WithMethodRate(100, 100))
+	method := "/test.v1.TestService/EmptyCall"
+
+	require.NoError(t, transporttest.Call(l.Middleware(), serverContext("idle-client", method), nil))
+	clock.Advance(sweepInterval - time.Second)
+	require.NoError(t, transporttest.Call(l.Middleware(), serverContext("busy-client", method), nil))
+	require.NoError(t, transporttest.Call(l.Middleware(), serverContext("busy-client", method), nil))
+
+	// 已回满的桶被清理，仍在恢复的桶保留
+	clock.Advance(time.Second)
+	require.NoError(t, transporttest.Call(l.Middleware(), serverContext("new-client", method), nil))
+	assert.ElementsMatch(t, []string{"busy-client", "new-client"}, keys(l.components))
+	assert.ElementsMatch(t, []string{method}, keys(l.methods))
+}
+
+func keys(m map[string]*bucket) []string {
+	var ks []string
+	for k := range m {
+		ks = append(ks, k)
+	}
+	return ks
+}
+
+func TestOptions_Invalid(t *testing.T) {
+	assert.Panics(t, func() { WithMaxConcurrent(0) })
+	assert.Panics(t, func() { WithMaxConcurrentPerComponent(-1) })
+	assert.Panics(t, func() { WithComponentRate(0, 10) })
+	assert.Panics(t, func() { WithMethodRate(10, 0) })
+}
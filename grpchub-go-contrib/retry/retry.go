@@ -0,0 +1,183 @@
+// Package retry retries unary calls routed through the hub, like the retry
+// policy of a plain gRPC service config.
+//
+// A Retrier belongs to one grpcx client. It retries calls that fail with a
+// retryable code, by default UNAVAILABLE, which includes the hub's
+// COMPONENT_OFFLINE error. Between attempts it waits the RetryInfo delay
+// the server sent, or else a random time below an exponential backoff:
+//
+//	r := retry.New(
+//		retry.WithMaxAttempts(4),
+//		retry.WithMethod("/test.v1.TestService/UnaryCall", retry.WithMaxAttempts(2)),
+//	)
+//	conn, _ := grpcx.NewClient("echo-server", ghc, grpcx.WithMiddleware(r.Middleware()))
+//
+// Streaming calls and hedging are not covered: whether a stream may be
+// retried depends on whether it has sent anything yet, which only the
+// SDK's call path knows.
+package retry
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/lisoboss/grpchub-go/middleware"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type policy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	multiplier     float64
+	codes          []codes.Code
+}
+
+type options struct {
+	policy
+	methods map[string][]Option
+}
+
+// Option configures a Retrier.
+type Option func(*options)
+
+// WithMaxAttempts sets how many times a call is tried, the first attempt
+// included. The default is 3. It panics if n is less than 1.
+func WithMaxAttempts(n int) Option {
+	if n < 1 {
+		panic(fmt.Sprintf("retry: WithMaxAttempts(%d): n must be at least 1", n))
+	}
+	return func(o *options) {
+		o.maxAttempts = n
+	}
+}
+
+// WithBackoff sets the backoff before the first retry, the limit it grows
+// to, and the factor it grows by after each retry. The wait is a random
+// time below the backoff. The defaults are 100ms, 1s and 2. It panics if
+// initial or limit is not positive or multiplier is less than 1.
+func WithBackoff(initial, limit time.Duration, multiplier float64) Option {
+	if initial <= 0 || limit <= 0 || !(multiplier >= 1) {
+		panic(fmt.Sprintf("retry: WithBackoff(%v, %v, %v): durations must be positive and multiplier at least 1", initial, limit, multiplier))
+	}
+	return func(o *options) {
+		o.initialBackoff = initial
+		o.maxBackoff = limit
+		o.multiplier = multiplier
+	}
+}
+
+// WithCodes replaces the status codes that are retried. The default is
+// UNAVAILABLE.
+func WithCodes(c ...codes.Code) Option {
+	return func(o *options) {
+		o.codes = c
+	}
+}
+
+// WithMethod applies opts on top of the other options for calls of
+// method, a full method name such as "/test.v1.TestService/UnaryCall".
+func WithMethod(method string, opts ...Option) Option {
+	return func(o *options) {
+		if o.methods == nil {
+			o.methods = make(map[string][]Option)
+		}
+		o.methods[method] = append(o.methods[method], opts...)
+	}
+}
+
+// Retrier retries the calls of one client.
+type Retrier struct {
+	policy  policy
+	methods map[string]policy
+
+	sleep func(context.Context, time.Duration) error
+	rand  func() float64
+}
+
+// New returns a Retrier with opts.
+func New(opts ...Option) *Retrier {
+	o := options{policy: policy{
+		maxAttempts:    3,
+		initialBackoff: 100 * time.Millisecond,
+		maxBackoff:     time.Second,
+		multiplier:     2,
+		codes:          []codes.Code{codes.Unavailable},
+	}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	r := &Retrier{
+		policy:  o.policy,
+		methods: make(map[string]policy, len(o.methods)),
+		sleep:   sleep,
+		rand:    rand.Float64,
+	}
+	for method, mopts := range o.methods {
+		mo := options{policy: o.policy}
+		for _, opt := range mopts {
+			opt(&mo)
+		}
+		r.methods[method] = mo.policy
+	}
+	return r
+}
+
+// Middleware returns the retrier as a client middleware.Middleware. If ctx
+// ends while it waits, the last attempt's error is returned.
+func (r *Retrier) Middleware() middleware.Middleware {
+	return func(next middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (any, error) {
+			p := r.policyFor(ctx)
+			for attempt := 1; ; attempt++ {
+				resp, err := next(ctx, req)
+				if err == nil || attempt >= p.maxAttempts || !slices.Contains(p.codes, status.Code(err)) {
+					return resp, err
+				}
+				if r.sleep(ctx, r.delay(p, attempt, err)) != nil {
+					return resp, err
+				}
+			}
+		}
+	}
+}
+
+func (r *Retrier) policyFor(ctx context.Context) policy {
+	if txp, ok := transport.FromClientContext(ctx); ok {
+		if p, ok := r.methods[txp.Operation()]; ok {
+			return p
+		}
+	}
+	return r.policy
+}
+
+// delay returns how long to wait after the failed attempt: the RetryInfo
+// delay of err if it has one, or else a random time below the backoff.
+func (r *Retrier) delay(p policy, attempt int, err error) time.Duration {
+	for _, d := range status.Convert(err).Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok && info.GetRetryDelay() != nil {
+			return info.GetRetryDelay().AsDuration()
+		}
+	}
+	backoff := float64(p.initialBackoff) * math.Pow(p.multiplier, float64(attempt-1))
+	return time.Duration(r.rand() * min(backoff, float64(p.maxBackoff)))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
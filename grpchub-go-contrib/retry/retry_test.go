@@ -0,0 +1,106 @@
+package retry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lisoboss/grpchub/grpchub-go-contrib/internal/transporttest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// newTestRetrier records its waits instead of sleeping and always waits
+// the full backoff.
+func newTestRetrier(opts ...Option) (*Retrier, *[]time.Duration) {
+	r := New(opts...)
+	var waits []time.Duration
+	r.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return ctx.Err()
+	}
+	r.rand = func() float64 { return 1 }
+	return r, &waits
+}
+
+// call fails with errs in turn and then succeeds. It returns how many
+// attempts were made and the result.
+func call(r *Retrier, ctx context.Context, errs ...error) (int, error) {
+	attempts := 0
+	_, err := r.Middleware()(func(context.Context, any) (any, error) {
+		attempts++
+		if attempts <= len(errs) {
+			return nil, errs[attempts-1]
+		}
+		return nil, nil
+	})(ctx, nil)
+	return attempts, err
+}
+
+func TestRetrier(t *testing.T) {
+	r, waits := newTestRetrier(WithMaxAttempts(4), WithBackoff(100*time.Millisecond, 300*time.Millisecond, 2))
+	ctx := context.Background()
+	unavailable := status.Error(codes.Unavailable, "target service is offline or not available")
+
+	attempts, err := call(r, ctx, unavailable, unavailable)
+	require.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}, *waits)
+
+	// 达到最大次数后返回最后一次的错误，退避不超过上限
+	*waits = nil
+	attempts, err = call(r, ctx, unavailable, unavailable, unavailable, unavailable, unavailable)
+	assert.Equal(t, unavailable, err)
+	assert.Equal(t, 4, attempts)
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond}, *waits)
+
+	// 不可重试的错误直接返回
+	notFound := status.Error(codes.NotFound, "no such user")
+	attempts, err = call(r, ctx, notFound)
+	assert.Equal(t, notFound, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestRetrier_RetryInfo(t *testing.T) {
+	r, waits := newTestRetrier(WithCodes(codes.ResourceExhausted))
+	st, err := status.New(codes.ResourceExhausted, "rate limit exceeded").WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(3 * time.Second),
+	})
+	require.NoError(t, err)
+
+	attempts, err := call(r, context.Background(), st.Err())
+	require.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, []time.Duration{3 * time.Second}, *waits)
+}
+
+func TestRetrier_PerMethod(t *testing.T) {
+	r, _ := newTestRetrier(WithMethod("/test.v1.TestService/UnaryCall", WithMaxAttempts(1)))
+	unavailable := status.Error(codes.Unavailable, "down")
+
+	attempts, _ := call(r, transporttest.ClientContext("/test.v1.TestService/UnaryCall"), unavailable, unavailable)
+	assert.Equal(t, 1, attempts)
+	attempts, _ = call(r, transporttest.ClientContext("/test.v1.TestService/EmptyCall"), unavailable, unavailable)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestRetrier_ContextDone(t *testing.T) {
+	r, _ := newTestRetrier()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	unavailable := status.Error(codes.Unavailable, "down")
+
+	attempts, err := call(r, ctx, unavailable, unavailable)
+	assert.Equal(t, unavailable, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestOptions_Invalid(t *testing.T) {
+	assert.Panics(t, func() { WithMaxAttempts(0) })
+	assert.Panics(t, func() { WithBackoff(0, time.Second, 2) })
+	assert.Panics(t, func() { WithBackoff(time.Millisecond, time.Second, 0.5) })
+}
@@ -0,0 +1,192 @@
+// Package tracing carries OpenTelemetry traces across the hub. The client
+// middleware starts a span for each call and injects its context into the
+// request header, which travels in PT_HEADER metadata as traceparent; the
+// server middleware extracts it and starts the server span as its child,
+// so a call through the hub comes out as one span tree:
+//
+//	conn, _ := grpcx.NewClient("echo-server", ghc,
+//		grpcx.WithMiddleware(tracing.Client()),
+//		grpcx.WithStreamTransportMiddleware(tracing.StreamClient()),
+//	)
+//	srv, _ := grpcx.NewServer("echo-server", ghc,
+//		grpcx.Middleware(tracing.Server()),
+//		grpcx.StreamTransportMiddleware(tracing.StreamServer()),
+//	)
+//
+// A stream gets one span from start to end. Per-message events, like the
+// ones a grpc stats.Handler records, need hooks in the SDK and are not
+// emitted.
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/lisoboss/grpchub-go/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/status"
+)
+
+const instrumentationName = "github.com/lisoboss/grpchub/grpchub-go-contrib/tracing"
+
+type options struct {
+	provider   trace.TracerProvider
+	propagator propagation.TextMapPropagator
+}
+
+// Option configures the tracing middleware.
+type Option func(*options)
+
+// WithTracerProvider sets the provider spans are started from. The
+// default is otel.GetTracerProvider().
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *options) {
+		o.provider = tp
+	}
+}
+
+// WithPropagator sets how span contexts are written to and read from the
+// request header. The default is otel.GetTextMapPropagator(), which must
+// then include propagation.TraceContext for traceparent to be sent.
+func WithPropagator(p propagation.TextMapPropagator) Option {
+	return func(o *options) {
+		o.propagator = p
+	}
+}
+
+type tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+func newTracer(opts []Option) *tracer {
+	o := options{
+		provider:   otel.GetTracerProvider(),
+		propagator: otel.GetTextMapPropagator(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &tracer{
+		tracer:     o.provider.Tracer(instrumentationName),
+		propagator: o.propagator,
+	}
+}
+
+// Client returns a client middleware.Middleware that traces unary calls.
+func Client(opts ...Option) middleware.Middleware {
+	t := newTracer(opts)
+	return func(next middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (any, error) {
+			ctx, span := t.startClient(ctx)
+			defer span.End()
+			resp, err := next(ctx, req)
+			record(span, err)
+			return resp, err
+		}
+	}
+}
+
+// Server returns a server middleware.Middleware that traces unary calls.
+func Server(opts ...Option) middleware.Middleware {
+	t := newTracer(opts)
+	return func(next middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (any, error) {
+			ctx, span := t.startServer(ctx)
+			defer span.End()
+			resp, err := next(ctx, req)
+			record(span, err)
+			return resp, err
+		}
+	}
+}
+
+// StreamClient returns a client middleware.StreamTransportMiddleware that
+// traces streams.
+func StreamClient(opts ...Option) middleware.StreamTransportMiddleware {
+	t := newTracer(opts)
+	return func(next middleware.StreamTransportHandler) middleware.StreamTransportHandler {
+		return func(ctx context.Context) error {
+			ctx, span := t.startClient(ctx)
+			defer span.End()
+			err := next(ctx)
+			record(span, err)
+			return err
+		}
+	}
+}
+
+// StreamServer returns a server middleware.StreamTransportMiddleware that
+// traces streams.
+func StreamServer(opts ...Option) middleware.StreamTransportMiddleware {
+	t := newTracer(opts)
+	return func(next middleware.StreamTransportHandler) middleware.StreamTransportHandler {
+		return func(ctx context.Context) error {
+			ctx, span := t.startServer(ctx)
+			defer span.End()
+			err := next(ctx)
+			record(span, err)
+			return err
+		}
+	}
+}
+
+func (t *tracer) startClient(ctx context.Context) (context.Context, trace.Span) {
+	txp, ok := transport.FromClientContext(ctx)
+	if !ok {
+		return t.tracer.Start(ctx, "", trace.WithSpanKind(trace.SpanKindClient))
+	}
+	ctx, span := t.tracer.Start(ctx, spanName(txp.Operation()),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attributes(txp.Operation())...),
+	)
+	if h := txp.RequestHeader(); h != nil {
+		t.propagator.Inject(ctx, h)
+	}
+	return ctx, span
+}
+
+func (t *tracer) startServer(ctx context.Context) (context.Context, trace.Span) {
+	txp, ok := transport.FromServerContext(ctx)
+	if !ok {
+		return t.tracer.Start(ctx, "", trace.WithSpanKind(trace.SpanKindServer))
+	}
+	if h := txp.RequestHeader(); h != nil {
+		ctx = t.propagator.Extract(ctx, h)
+	}
+	return t.tracer.Start(ctx, spanName(txp.Operation()),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attributes(txp.Operation())...),
+	)
+}
+
+// spanName turns "/test.v1.TestService/UnaryCall" into
+// "test.v1.TestService/UnaryCall", the name otelgrpc gives the span.
+func spanName(fullMethod string) string {
+	return strings.TrimPrefix(fullMethod, "/")
+}
+
+func attributes(fullMethod string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{attribute.String("rpc.system", "grpc")}
+	service, method, ok := strings.Cut(spanName(fullMethod), "/")
+	if ok {
+		attrs = append(attrs,
+			attribute.String("rpc.service", service),
+			attribute.String("rpc.method", method),
+		)
+	}
+	return attrs
+}
+
+func record(span trace.Span, err error) {
+	st := status.Convert(err)
+	span.SetAttributes(attribute.Int64("rpc.grpc.status_code", int64(st.Code())))
+	if err != nil {
+		span.SetStatus(otelcodes.Error, st.Message())
+	}
+}
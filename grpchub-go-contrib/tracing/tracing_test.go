@@ -0,0 +1,86 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/lisoboss/grpchub/grpchub-go-contrib/internal/transporttest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newTestOptions() ([]Option, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	return []Option{
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))),
+		WithPropagator(propagation.TraceContext{}),
+	}, recorder
+}
+
+// relay returns the server context of the call in client context ctx,
+// with the request header the hub passes on in PT_HEADER metadata.
+func relay(ctx context.Context) context.Context {
+	client, _ := transport.FromClientContext(ctx)
+	srv := transporttest.NewTransport(client.Operation())
+	for _, k := range client.RequestHeader().Keys() {
+		srv.Request.Set(k, client.RequestHeader().Get(k))
+	}
+	return transport.NewServerContext(context.Background(), srv)
+}
+
+func TestClientServer(t *testing.T) {
+	opts, recorder := newTestOptions()
+	var serverSpan trace.SpanContext
+	handler := func(ctx context.Context, req any) (any, error) {
+		serverSpan = trace.SpanContextFromContext(ctx)
+		return nil, status.Error(codes.NotFound, "no such user")
+	}
+
+	ctx := transporttest.ClientContext("/test.v1.TestService/UnaryCall")
+	_, err := Client(opts...)(func(ctx context.Context, req any) (any, error) {
+		return Server(opts...)(handler)(relay(ctx), req)
+	})(ctx, nil)
+	require.Error(t, err)
+
+	txp, _ := transport.FromClientContext(ctx)
+	assert.NotEmpty(t, txp.RequestHeader().Get("traceparent"))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	srv, cli := spans[0], spans[1]
+	assert.Equal(t, "test.v1.TestService/UnaryCall", cli.Name())
+	assert.Equal(t, trace.SpanKindClient, cli.SpanKind())
+	assert.Equal(t, trace.SpanKindServer, srv.SpanKind())
+
+	// 服务端 span 是客户端 span 的子 span，处于同一条 trace
+	assert.Equal(t, cli.SpanContext().TraceID(), srv.SpanContext().TraceID())
+	assert.Equal(t, cli.SpanContext().SpanID(), srv.Parent().SpanID())
+	assert.True(t, srv.Parent().IsRemote())
+	assert.Equal(t, srv.SpanContext().SpanID(), serverSpan.SpanID())
+
+	assert.Equal(t, otelcodes.Error, cli.Status().Code)
+	assert.Equal(t, "no such user", srv.Status().Description)
+}
+
+func TestStream(t *testing.T) {
+	opts, recorder := newTestOptions()
+	ctx := transporttest.ClientContext("/test.v1.TestService/BidirectionalStream")
+
+	err := StreamClient(opts...)(func(ctx context.Context) error {
+		return StreamServer(opts...)(func(context.Context) error { return nil })(relay(ctx))
+	})(ctx)
+	require.NoError(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Equal(t, otelcodes.Unset, spans[1].Status().Code)
+}
@@ -0,0 +1,304 @@
+// Package capture records the ChannelMessage traffic of a hub to a file,
+// prints it and replays it.
+//
+// A capture file is a sequence of capturev1.Record messages, each prefixed
+// with its varint-encoded length (protodelim). hub.WithCapture writes one
+// record for every package a component sends to the hub and every package
+// the hub delivers to a component.
+package capture
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	capturev1 "grpchub-test/gen/capture/v1"
+
+	channel "github.com/lisoboss/grpchub-go/gen/channel/v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Writer appends records to a capture file. It is safe for concurrent use.
+type Writer struct {
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+// NewWriter returns a Writer that writes to w. Call Flush before closing w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Write records msg as seen on the Channel stream of componentID.
+func (w *Writer) Write(dir capturev1.Direction, componentID, receiverID string, msg *channel.ChannelMessage) error {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal message: %w", err)
+	}
+	rec := &capturev1.Record{
+		CaptureTime: timestamppb.Now(),
+		Direction:   dir,
+		ComponentId: componentID,
+		ReceiverId:  receiverID,
+		Message:     data,
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err = protodelim.MarshalTo(w.w, rec)
+	return err
+}
+
+// Flush writes buffered records to the underlying writer.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Flush()
+}
+
+// Reader reads records from a capture file.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader returns a Reader that reads from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next record and its decoded message, or io.EOF at the
+// end of the capture.
+func (r *Reader) Next() (*capturev1.Record, *channel.ChannelMessage, error) {
+	rec := &capturev1.Record{}
+	if err := (protodelim.UnmarshalOptions{MaxSize: -1}).UnmarshalFrom(r.r, rec); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil, io.EOF
+		}
+		return nil, nil, fmt.Errorf("read record: %w", err)
+	}
+	msg := &channel.ChannelMessage{}
+	if err := proto.Unmarshal(rec.GetMessage(), msg); err != nil {
+		return nil, nil, fmt.Errorf("decode message: %w", err)
+	}
+	return rec, msg, nil
+}
+
+// Resolver finds payload types by URL, such as protoregistry.GlobalTypes
+// or the types returned by LoadDescriptors.
+type Resolver interface {
+	protoregistry.MessageTypeResolver
+	protoregistry.ExtensionTypeResolver
+}
+
+// LoadDescriptors reads a self-contained FileDescriptorSet, as written by
+// `buf build -o` or `protoc --include_imports --descriptor_set_out`.
+func LoadDescriptors(path string) (Resolver, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return dynamicpb.NewTypes(files), nil
+}
+
+// Print writes every record of r to w in a readable form. Payloads whose
+// type types resolves are shown as JSON; types may be nil to use
+// protoregistry.GlobalTypes.
+func Print(w io.Writer, r *Reader, types Resolver) error {
+	if types == nil {
+		types = protoregistry.GlobalTypes
+	}
+	for {
+		rec, msg, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := PrintRecord(w, rec, msg, types); err != nil {
+			return err
+		}
+	}
+}
+
+// PrintRecord writes one record in the form Print uses.
+func PrintRecord(w io.Writer, rec *capturev1.Record, msg *channel.ChannelMessage, types Resolver) error {
+	if types == nil {
+		types = protoregistry.GlobalTypes
+	}
+	var b strings.Builder
+
+	route := fmt.Sprintf("hub => %s", rec.GetComponentId())
+	if rec.GetDirection() == capturev1.Direction_DIRECTION_INBOUND {
+		route = fmt.Sprintf("%s => hub (%s)", rec.GetComponentId(), rec.GetReceiverId())
+	}
+	pkg := msg.GetPkg()
+	fmt.Fprintf(&b, "%s  %s  sid=%s  %s",
+		rec.GetCaptureTime().AsTime().Format(time.RFC3339Nano), route, msg.GetSid(), pkg.GetType())
+	if pkg.GetMethod() != "" {
+		fmt.Fprintf(&b, "  %s", pkg.GetMethod())
+	}
+	if pkg.GetWindowIncrement() != 0 {
+		fmt.Fprintf(&b, "  window_increment=%d", pkg.GetWindowIncrement())
+	}
+	b.WriteString("\n")
+
+	for _, e := range pkg.GetMd() {
+		fmt.Fprintf(&b, "    md %s: %s\n", e.GetKey(), strings.Join(e.GetValues(), ", "))
+	}
+	if payload := pkg.GetPayload(); payload != nil {
+		fmt.Fprintf(&b, "    payload %s\n", formatPayload(payload, types))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func formatPayload(payload *anypb.Any, types Resolver) string {
+	m, err := anypb.UnmarshalNew(payload, proto.UnmarshalOptions{Resolver: types})
+	if err != nil {
+		return fmt.Sprintf("%s (%d bytes, not decoded: %v)", payload.GetTypeUrl(), len(payload.GetValue()), err)
+	}
+	data, err := protojson.MarshalOptions{Resolver: types}.Marshal(m)
+	if err != nil {
+		return fmt.Sprintf("%s (%d bytes, not decoded: %v)", payload.GetTypeUrl(), len(payload.GetValue()), err)
+	}
+	return fmt.Sprintf("%s %s", m.ProtoReflect().Descriptor().FullName(), data)
+}
+
+// Session returns what componentID sent to the hub in a capture: the
+// receiver_id of its Channel stream and its packages in order.
+func Session(r *Reader, componentID string) (receiverID string, msgs []*channel.ChannelMessage, err error) {
+	for {
+		rec, msg, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		if rec.GetDirection() != capturev1.Direction_DIRECTION_INBOUND || rec.GetComponentId() != componentID {
+			continue
+		}
+		receiverID = rec.GetReceiverId()
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) == 0 {
+		return "", nil, fmt.Errorf("no packages from %q in capture", componentID)
+	}
+	return receiverID, msgs, nil
+}
+
+// ErrComponentOnline is returned by Replay when a component with the
+// sender ID is registered with the hub.
+var ErrComponentOnline = errors.New("component is online")
+
+type replayOptions struct {
+	force bool
+}
+
+// ReplayOption configures Replay.
+type ReplayOption func(*replayOptions)
+
+// WithForce makes Replay register even if a component with the sender ID
+// is online. The replay then takes over its registration, and the ID stays
+// unregistered after Replay returns until that component reconnects.
+func WithForce() ReplayOption {
+	return func(o *replayOptions) {
+		o.force = true
+	}
+}
+
+// Replay opens a Channel stream as senderID to receiverID, sends msgs in
+// order and passes every package received to onRecv, which may be nil. It
+// returns once every sid in msgs that was not canceled has ended with
+// PT_CLOSE or PT_ERROR, the stream ends, or ctx is done.
+//
+// The stream registers senderID with the hub like any component does. If
+// ListComponents shows senderID online, Replay returns ErrComponentOnline
+// without sending anything, unless WithForce is given.
+func Replay(ctx context.Context, client channel.ChannelServiceClient, senderID, receiverID string, msgs []*channel.ChannelMessage, onRecv func(*channel.ChannelMessage), opts ...ReplayOption) error {
+	var o replayOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if !o.force {
+		resp, err := client.ListComponents(ctx, &channel.ListComponentsRequest{})
+		if err != nil {
+			return fmt.Errorf("list components: %w", err)
+		}
+		if slices.Contains(resp.GetComponentIds(), senderID) {
+			return fmt.Errorf("%q: %w", senderID, ErrComponentOnline)
+		}
+	}
+
+	if onRecv == nil {
+		onRecv = func(*channel.ChannelMessage) {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "sender_id", senderID, "receiver_id", receiverID)
+
+	stream, err := client.Channel(ctx)
+	if err != nil {
+		return err
+	}
+
+	var open []string
+	for _, msg := range msgs {
+		// 被调用方取消的 sid 不会再有回复
+		if msg.GetPkg().GetType() == channel.PackageType_PT_CANCEL {
+			open = slices.DeleteFunc(open, func(sid string) bool {
+				return sid == msg.GetSid()
+			})
+		} else if !slices.Contains(open, msg.GetSid()) {
+			open = append(open, msg.GetSid())
+		}
+		if err := stream.Send(msg); err != nil {
+			return err
+		}
+	}
+
+	for len(open) > 0 {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		onRecv(msg)
+
+		switch msg.GetPkg().GetType() {
+		case channel.PackageType_PT_CLOSE, channel.PackageType_PT_ERROR:
+			open = slices.DeleteFunc(open, func(sid string) bool {
+				return sid == msg.GetSid()
+			})
+		}
+	}
+	return stream.CloseSend()
+}
@@ -0,0 +1,65 @@
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	capturev1 "grpchub-test/gen/capture/v1"
+
+	channel "github.com/lisoboss/grpchub-go/gen/channel/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestWriterReader(t *testing.T) {
+	st, err := anypb.New(status.New(codes.NotFound, "no such user").Proto())
+	require.NoError(t, err)
+	msgs := []*channel.ChannelMessage{
+		{Sid: "1", Pkg: &channel.MessagePackage{
+			Type:   channel.PackageType_PT_HEADER,
+			Method: "/test.TestService/UnaryCall",
+			Md:     []*channel.MetadataEntry{{Key: "x-request-id", Values: []string{"42"}}},
+		}},
+		{Sid: "1", Pkg: &channel.MessagePackage{
+			Type:    channel.PackageType_PT_PAYLOAD,
+			Payload: &anypb.Any{TypeUrl: "type.googleapis.com/test.UnaryRequest", Value: []byte{0x0a, 0x01, 0x61}},
+		}},
+		{Sid: "1", Pkg: &channel.MessagePackage{Type: channel.PackageType_PT_ERROR, Payload: st}},
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	require.NoError(t, w.Write(capturev1.Direction_DIRECTION_INBOUND, "echo-client", "echo-server", msgs[0]))
+	require.NoError(t, w.Write(capturev1.Direction_DIRECTION_INBOUND, "echo-client", "echo-server", msgs[1]))
+	require.NoError(t, w.Write(capturev1.Direction_DIRECTION_OUTBOUND, "echo-client", "echo-server", msgs[2]))
+	require.NoError(t, w.Flush())
+
+	r := NewReader(bytes.NewReader(buf.Bytes()))
+	for _, want := range msgs {
+		rec, msg, err := r.Next()
+		require.NoError(t, err)
+		assert.Equal(t, "echo-client", rec.GetComponentId())
+		assert.True(t, proto.Equal(want, msg))
+	}
+	_, _, err = r.Next()
+	assert.True(t, errors.Is(err, io.EOF))
+
+	var out strings.Builder
+	require.NoError(t, Print(&out, NewReader(bytes.NewReader(buf.Bytes())), nil))
+	lines := out.String()
+	assert.Contains(t, lines, "echo-client => hub (echo-server)  sid=1  PT_HEADER  /test.TestService/UnaryCall\n")
+	assert.Contains(t, lines, "    md x-request-id: 42\n")
+	// 未注册的类型只打印类型和长度
+	assert.Contains(t, lines, "    payload type.googleapis.com/test.UnaryRequest (3 bytes, not decoded")
+	assert.Contains(t, lines, "hub => echo-client  sid=1  PT_ERROR\n")
+	// protojson 的空白不稳定，只检查类型和内容
+	assert.Contains(t, lines, "    payload google.rpc.Status {")
+	assert.Contains(t, lines, `"no such user"`)
+}
@@ -0,0 +1,204 @@
+// Command grpchub bundles GrpcHub tooling.
+//
+//	grpchub certs [-dir certs] [-domain example.com] [-ip 192.168.1.100]
+//	grpchub certs -component echo-server [-ttl 24h] [-dir certs] [-out echo-server.pem]
+//	grpchub capture print [-descriptors set.binpb] <file>
+//	grpchub capture replay -component echo-client [-hub [::1]:50055] [-cert client.pem] [-force] <file>
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"grpchub-test/capture"
+	capturev1 "grpchub-test/gen/capture/v1"
+
+	channel "github.com/lisoboss/grpchub-go/gen/channel/v1"
+	"github.com/lisoboss/grpchub/grpchub-go-contrib/certs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func usage() {
+	fmt.Println("Usage: grpchub <command> [flags]")
+	fmt.Println("")
+	fmt.Println("Commands:")
+	fmt.Println("  certs            Generate the CA, server and client certificates, or issue a component certificate")
+	fmt.Println("  capture print    Pretty-print a Channel capture file")
+	fmt.Println("  capture replay   Send one component's packages from a capture through a hub again")
+	fmt.Println("")
+	fmt.Println("Run 'grpchub <command> -h' for the flags of a command.")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "certs":
+		runCerts(os.Args[2:])
+	case "capture":
+		if len(os.Args) < 3 {
+			usage()
+			os.Exit(2)
+		}
+		switch os.Args[2] {
+		case "print":
+			runCapturePrint(os.Args[3:])
+		case "replay":
+			runCaptureReplay(os.Args[3:])
+		default:
+			usage()
+			os.Exit(2)
+		}
+	case "-h", "--help", "help":
+		usage()
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+func runCerts(args []string) {
+	fs := flag.NewFlagSet("certs", flag.ExitOnError)
+	dir := fs.String("dir", "certs", "certificate directory")
+	domain := fs.String("domain", os.Getenv("GRPCHUB_DOMAIN"), "server domain (default $GRPCHUB_DOMAIN)")
+	ip := fs.String("ip", os.Getenv("GRPCHUB_IP"), "server IP address (default $GRPCHUB_IP)")
+	component := fs.String("component", "", "issue a certificate for this component ID from <dir>/ca.crt and <dir>/ca.key")
+	ttl := fs.Duration("ttl", 24*time.Hour, "validity of a component certificate")
+	out := fs.String("out", "", "component PEM file (default <dir>/<component>.pem)")
+	_ = fs.Parse(args)
+
+	if *component != "" {
+		ca, err := certs.LoadCAFiles(*dir)
+		if err != nil {
+			log.Fatal("Failed to load CA: ", err)
+		}
+		path := *out
+		if path == "" {
+			path = filepath.Join(*dir, *component+".pem")
+		}
+		if err := certs.WriteComponentPEM(ca, *component, *ttl, path); err != nil {
+			log.Fatal("Failed to issue component certificate: ", err)
+		}
+		log.Printf("Issued %s for %q, valid for %s", path, *component, *ttl)
+		return
+	}
+
+	hosts, err := certs.Hosts(*domain, *ip)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := certs.WriteFiles(*dir, hosts); err != nil {
+		log.Fatal("Failed to generate certificates: ", err)
+	}
+	log.Printf("Generated ca, server and client certificates in %s", *dir)
+	log.Printf("Server SANs: %v", hosts)
+}
+
+func runCapturePrint(args []string) {
+	fs := flag.NewFlagSet("capture print", flag.ExitOnError)
+	descriptors := fs.String("descriptors", "", "FileDescriptorSet used to decode payloads (buf build -o / protoc --include_imports --descriptor_set_out)")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatal("Usage: grpchub capture print [-descriptors set.binpb] <file>")
+	}
+
+	var types capture.Resolver
+	if *descriptors != "" {
+		var err error
+		if types, err = capture.LoadDescriptors(*descriptors); err != nil {
+			log.Fatal("Failed to load descriptors: ", err)
+		}
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		log.Fatal("Failed to open capture: ", err)
+	}
+	defer f.Close()
+
+	if err := capture.Print(os.Stdout, capture.NewReader(f), types); err != nil {
+		log.Fatal("Failed to print capture: ", err)
+	}
+}
+
+func runCaptureReplay(args []string) {
+	fs := flag.NewFlagSet("capture replay", flag.ExitOnError)
+	hubAddr := fs.String("hub", "[::1]:50055", "hub address")
+	certFile := fs.String("cert", "client.pem", "combined client PEM (certificate, key and CA)")
+	component := fs.String("component", "", "component whose packages are replayed; the replay registers under this ID")
+	force := fs.Bool("force", false, "replay even if the component is online, taking over its registration and leaving the ID unregistered when done")
+	receiver := fs.String("receiver", "", "receiver_id to replay to (default the one in the capture)")
+	timeout := fs.Duration("timeout", 10*time.Second, "how long to wait for the replies")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 || *component == "" {
+		log.Fatal("Usage: grpchub capture replay -component <id> [-hub addr] [-cert client.pem] [-receiver id] [-force] <file>")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		log.Fatal("Failed to open capture: ", err)
+	}
+	receiverID, msgs, err := capture.Session(capture.NewReader(f), *component)
+	f.Close()
+	if err != nil {
+		log.Fatal("Failed to read capture: ", err)
+	}
+	if *receiver != "" {
+		receiverID = *receiver
+	}
+
+	creds, err := loadClientCredentials(*certFile)
+	if err != nil {
+		log.Fatal("Failed to load TLS credentials: ", err)
+	}
+	conn, err := grpc.NewClient(*hubAddr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		log.Fatal("Failed to connect to hub: ", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var opts []capture.ReplayOption
+	if *force {
+		opts = append(opts, capture.WithForce())
+	}
+	log.Printf("Replaying %d packages from %s to %s", len(msgs), *component, receiverID)
+	err = capture.Replay(ctx, channel.NewChannelServiceClient(conn), *component, receiverID, msgs, func(msg *channel.ChannelMessage) {
+		rec := &capturev1.Record{
+			CaptureTime: timestamppb.Now(),
+			Direction:   capturev1.Direction_DIRECTION_OUTBOUND,
+			ComponentId: *component,
+			ReceiverId:  receiverID,
+		}
+		_ = capture.PrintRecord(os.Stdout, rec, msg, nil)
+	}, opts...)
+	if err != nil {
+		log.Fatal("Replay failed: ", err)
+	}
+}
+
+// loadClientCredentials reads a combined PEM file the way StartHub reads
+// server.pem: the certificate and key plus the CA that verifies the hub.
+func loadClientCredentials(path string) (credentials.TransportCredentials, error) {
+	cert, roots, err := certs.LoadKeyPair(path)
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      roots,
+	}), nil
+}
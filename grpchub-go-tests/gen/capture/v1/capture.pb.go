@@ -0,0 +1,220 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: capture/v1/capture.proto
+
+package capturev1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Direction int32
+
+const (
+	Direction_DIRECTION_UNSPECIFIED Direction = 0
+	Direction_DIRECTION_INBOUND     Direction = 1
+	Direction_DIRECTION_OUTBOUND    Direction = 2
+)
+
+// Enum value maps for Direction.
+var (
+	Direction_name = map[int32]string{
+		0: "DIRECTION_UNSPECIFIED",
+		1: "DIRECTION_INBOUND",
+		2: "DIRECTION_OUTBOUND",
+	}
+	Direction_value = map[string]int32{
+		"DIRECTION_UNSPECIFIED": 0,
+		"DIRECTION_INBOUND":     1,
+		"DIRECTION_OUTBOUND":    2,
+	}
+)
+
+func (x Direction) Enum() *Direction {
+	p := new(Direction)
+	*p = x
+	return p
+}
+
+func (x Direction) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Direction) Descriptor() protoreflect.EnumDescriptor {
+	return file_capture_v1_capture_proto_enumTypes[0].Descriptor()
+}
+
+func (Direction) Type() protoreflect.EnumType {
+	return &file_capture_v1_capture_proto_enumTypes[0]
+}
+
+func (x Direction) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Direction.Descriptor instead.
+func (Direction) EnumDescriptor() ([]byte, []int) {
+	return file_capture_v1_capture_proto_rawDescGZIP(), []int{0}
+}
+
+type Record struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CaptureTime   *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=capture_time,json=captureTime,proto3" json:"capture_time,omitempty"`
+	Direction     Direction              `protobuf:"varint,2,opt,name=direction,proto3,enum=capture.v1.Direction" json:"direction,omitempty"`
+	ComponentId   string                 `protobuf:"bytes,3,opt,name=component_id,json=componentId,proto3" json:"component_id,omitempty"`
+	ReceiverId    string                 `protobuf:"bytes,4,opt,name=receiver_id,json=receiverId,proto3" json:"receiver_id,omitempty"`
+	Message       []byte                 `protobuf:"bytes,5,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Record) Reset() {
+	*x = Record{}
+	mi := &file_capture_v1_capture_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Record) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Record) ProtoMessage() {}
+
+func (x *Record) ProtoReflect() protoreflect.Message {
+	mi := &file_capture_v1_capture_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Record.ProtoReflect.Descriptor instead.
+func (*Record) Descriptor() ([]byte, []int) {
+	return file_capture_v1_capture_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Record) GetCaptureTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CaptureTime
+	}
+	return nil
+}
+
+func (x *Record) GetDirection() Direction {
+	if x != nil {
+		return x.Direction
+	}
+	return Direction_DIRECTION_UNSPECIFIED
+}
+
+func (x *Record) GetComponentId() string {
+	if x != nil {
+		return x.ComponentId
+	}
+	return ""
+}
+
+func (x *Record) GetReceiverId() string {
+	if x != nil {
+		return x.ReceiverId
+	}
+	return ""
+}
+
+func (x *Record) GetMessage() []byte {
+	if x != nil {
+		return x.Message
+	}
+	return nil
+}
+
+var File_capture_v1_capture_proto protoreflect.FileDescriptor
+
+const file_capture_v1_capture_proto_rawDesc = "" +
+	"\n" +
+	"\x18capture/v1/capture.proto\x12\n" +
+	"capture.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xda\x01\n" +
+	"\x06Record\x12=\n" +
+	"\fcapture_time\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\vcaptureTime\x123\n" +
+	"\tdirection\x18\x02 \x01(\x0e2\x15.capture.v1.DirectionR\tdirection\x12!\n" +
+	"\fcomponent_id\x18\x03 \x01(\tR\vcomponentId\x12\x1f\n" +
+	"\vreceiver_id\x18\x04 \x01(\tR\n" +
+	"receiverId\x12\x18\n" +
+	"\amessage\x18\x05 \x01(\fR\amessage*U\n" +
+	"\tDirection\x12\x19\n" +
+	"\x15DIRECTION_UNSPECIFIED\x10\x00\x12\x15\n" +
+	"\x11DIRECTION_INBOUND\x10\x01\x12\x16\n" +
+	"\x12DIRECTION_OUTBOUND\x10\x02B'Z%grpchub-test/gen/capture/v1;capturev1b\x06proto3"
+
+var (
+	file_capture_v1_capture_proto_rawDescOnce sync.Once
+	file_capture_v1_capture_proto_rawDescData []byte
+)
+
+func file_capture_v1_capture_proto_rawDescGZIP() []byte {
+	file_capture_v1_capture_proto_rawDescOnce.Do(func() {
+		file_capture_v1_capture_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_capture_v1_capture_proto_rawDesc), len(file_capture_v1_capture_proto_rawDesc)))
+	})
+	return file_capture_v1_capture_proto_rawDescData
+}
+
+var file_capture_v1_capture_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_capture_v1_capture_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_capture_v1_capture_proto_goTypes = []any{
+	(Direction)(0),                // 0: capture.v1.Direction
+	(*Record)(nil),                // 1: capture.v1.Record
+	(*timestamppb.Timestamp)(nil), // 2: google.protobuf.Timestamp
+}
+var file_capture_v1_capture_proto_depIdxs = []int32{
+	2, // 0: capture.v1.Record.capture_time:type_name -> google.protobuf.Timestamp
+	0, // 1: capture.v1.Record.direction:type_name -> capture.v1.Direction
+	2, // [2:2] is the sub-list for method output_type
+	2, // [2:2] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_capture_v1_capture_proto_init() }
+func file_capture_v1_capture_proto_init() {
+	if File_capture_v1_capture_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_capture_v1_capture_proto_rawDesc), len(file_capture_v1_capture_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_capture_v1_capture_proto_goTypes,
+		DependencyIndexes: file_capture_v1_capture_proto_depIdxs,
+		EnumInfos:         file_capture_v1_capture_proto_enumTypes,
+		MessageInfos:      file_capture_v1_capture_proto_msgTypes,
+	}.Build()
+	File_capture_v1_capture_proto = out.File
+	file_capture_v1_capture_proto_goTypes = nil
+	file_capture_v1_capture_proto_depIdxs = nil
+}
@@ -0,0 +1,525 @@
+// Package hub is a pure-Go implementation of channel.v1.ChannelService.
+//
+// It relays ChannelMessage packages between components the same way
+// ChannelServer in grpchub-serve does, so a whole hub can run inside a Go
+// process or a `go test` binary:
+//
+//	gs := grpc.NewServer(grpc.Creds(creds))
+//	hub.NewServer().Register(gs)
+//	go gs.Serve(lis) // net.Listener or bufconn.Listener
+//
+// It is meant for this repository's tests and tools; deployments run
+// grpchub-serve.
+package hub
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"grpchub-test/capture"
+	capturev1 "grpchub-test/gen/capture/v1"
+
+	channel "github.com/lisoboss/grpchub-go/gen/channel/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+const (
+	// ErrorDomain is the ErrorInfo domain of errors produced by the hub itself.
+	ErrorDomain = "grpchub"
+	// ReasonComponentOffline is the ErrorInfo reason sent when the receiver
+	// is not registered. Its metadata carries the addressed component_id.
+	ReasonComponentOffline = "COMPONENT_OFFLINE"
+
+	// SenderIDHeader is the PT_HEADER metadata key the hub sets to the
+	// sending component's ID, replacing any value the sender supplied.
+	SenderIDHeader = "grpchub-sender-id"
+)
+
+const (
+	senderIDKey   = "sender_id"
+	receiverIDKey = "receiver_id"
+	groupIDKey    = "group_id"
+
+	// channelBuffer matches the mpsc::channel(32) used by grpchub-serve.
+	channelBuffer = 32
+	// eventBuffer matches the broadcast::channel(64) used by grpchub-serve.
+	eventBuffer = 64
+)
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithLogger sets the logger used for connect, disconnect and relay events.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// WithCapture records every package components send to the hub and every
+// package the hub delivers to them. Flush w after the hub has stopped.
+func WithCapture(w *capture.Writer) Option {
+	return func(s *Server) {
+		s.capture = w
+	}
+}
+
+// Server relays packages between the Channel streams of registered components.
+type Server struct {
+	channel.UnimplementedChannelServiceServer
+
+	logger   *slog.Logger
+	verifier IdentityVerifier
+	capture  *capture.Writer
+
+	mu       sync.RWMutex
+	channels map[string]*conn
+	watchers map[chan *channel.WatchComponentsResponse]struct{}
+
+	// groups holds the members of each component group. Replicas register
+	// under their own sender_id and join a group via group_id metadata;
+	// new sids sent to the group name are spread round-robin and stay
+	// pinned to one member through sessions.
+	groups   map[string]*group
+	sessions map[sessionKey]*session
+}
+
+type group struct {
+	members []string
+	next    int
+}
+
+type sessionKey struct {
+	senderID string
+	sid      string
+}
+
+// session is a sid of one caller stream pinned to the Channel stream of
+// one group member. A caller that reconnects restarts its sids, so a
+// session belongs to the stream that opened it, not to the caller's ID.
+type session struct {
+	groupID string
+	caller  *conn
+	member  *conn
+}
+
+// conn is the outgoing side of one registered Channel stream.
+type conn struct {
+	ch   chan *channel.ChannelMessage
+	done chan struct{}
+}
+
+// NewServer creates an empty hub.
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		logger:   slog.Default(),
+		channels: make(map[string]*conn),
+		watchers: make(map[chan *channel.WatchComponentsResponse]struct{}),
+		groups:   make(map[string]*group),
+		sessions: make(map[sessionKey]*session),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// Register mounts the hub on a *grpc.Server (or any grpc.ServiceRegistrar).
+func (s *Server) Register(r grpc.ServiceRegistrar) {
+	channel.RegisterChannelServiceServer(r, s)
+}
+
+// Channel implements channel.ChannelServiceServer.
+func (s *Server) Channel(stream channel.ChannelService_ChannelServer) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	senderID, err := parseMetadataValue(md, senderIDKey)
+	if err != nil {
+		return err
+	}
+	receiverID, err := parseMetadataValue(md, receiverIDKey)
+	if err != nil {
+		return err
+	}
+	groupID, _ := parseMetadataValue(md, groupIDKey)
+
+	// 校验组件 ID 与调用方身份是否匹配
+	if s.verifier != nil {
+		for _, id := range []string{senderID, groupID} {
+			if id == "" {
+				continue
+			}
+			if err := s.verifier(stream.Context(), id); err != nil {
+				s.logger.Warn("registration rejected", "component_id", id, "err", err)
+				return err
+			}
+		}
+	}
+
+	// 初始化通道
+	c := &conn{
+		ch:   make(chan *channel.ChannelMessage, channelBuffer),
+		done: make(chan struct{}),
+	}
+
+	// 注册信息
+	s.mu.Lock()
+	if _, ok := s.channels[senderID]; !ok {
+		s.publish(channel.ComponentEventType_COMPONENT_EVENT_TYPE_ONLINE, senderID)
+	}
+	s.channels[senderID] = c
+	if groupID != "" {
+		s.joinGroup(groupID, senderID)
+	}
+	s.mu.Unlock()
+	s.logger.Info("client connected", "sender_id", senderID)
+
+	go func() {
+		defer close(c.done)
+		s.relay(stream, c, senderID, receiverID)
+
+		// 下线清理；重连后的新通道已覆盖注册时不能删除
+		s.mu.Lock()
+		if s.channels[senderID] == c {
+			delete(s.channels, senderID)
+			if groupID != "" {
+				s.leaveGroup(groupID, senderID)
+			}
+			s.publish(channel.ComponentEventType_COMPONENT_EVENT_TYPE_OFFLINE, senderID)
+		}
+		lost := s.endSessions(c)
+		s.mu.Unlock()
+		s.logger.Info("client disconnected", "sender_id", senderID)
+
+		// 绑定在本通道上的会话通知调用方
+		for _, l := range lost {
+			select {
+			case l.caller.ch <- &channel.ChannelMessage{Sid: l.sid, Pkg: newErrorNotFound(l.groupID)}:
+			case <-l.caller.done:
+			}
+		}
+	}()
+
+	send := func(msg *channel.ChannelMessage) error {
+		s.record(capturev1.Direction_DIRECTION_OUTBOUND, senderID, receiverID, msg)
+		return stream.Send(msg)
+	}
+	for {
+		select {
+		case msg := <-c.ch:
+			if err := send(msg); err != nil {
+				return err
+			}
+		case <-c.done:
+			// Flush whatever was queued before the sender went away,
+			// including a PT_ERROR for an offline receiver.
+			for {
+				select {
+				case msg := <-c.ch:
+					if err := send(msg); err != nil {
+						return err
+					}
+				default:
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// relay forwards every message received on stream to receiverID until the
+// stream ends or the receiver is found offline.
+func (s *Server) relay(stream channel.ChannelService_ChannelServer, c *conn, senderID, receiverID string) {
+	ctx := stream.Context()
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return
+		}
+		s.record(capturev1.Direction_DIRECTION_INBOUND, senderID, receiverID, msg)
+		switch msg.GetPkg().GetType() {
+		case channel.PackageType_PT_HEADER:
+			stampSenderID(msg.GetPkg(), senderID)
+		case channel.PackageType_PT_CLOSE, channel.PackageType_PT_ERROR:
+			// 组成员结束了会话
+			s.endSession(receiverID, msg.GetSid(), c)
+		}
+
+		dst, grouped := s.route(c, senderID, receiverID, msg)
+		if grouped && dst == nil && endsSession(msg.GetPkg().GetType()) {
+			// 已结束会话上迟到的包
+			continue
+		}
+		if dst == nil {
+			select {
+			case c.ch <- &channel.ChannelMessage{Sid: msg.GetSid(), Pkg: newErrorNotFound(receiverID)}:
+			case <-ctx.Done():
+				return
+			}
+			// 组内其他会话不受影响
+			if grouped {
+				continue
+			}
+			return
+		}
+
+		s.logger.Debug("send",
+			"sid", msg.GetSid(),
+			"type", msg.GetPkg().GetType().String(),
+			"receiver_id", receiverID,
+		)
+		select {
+		case dst.ch <- msg:
+		case <-dst.done:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Server) record(dir capturev1.Direction, senderID, receiverID string, msg *channel.ChannelMessage) {
+	if s.capture == nil {
+		return
+	}
+	if err := s.capture.Write(dir, senderID, receiverID, msg); err != nil {
+		s.logger.Warn("capture failed", "sid", msg.GetSid(), "err", err)
+	}
+}
+
+// route resolves where a message from c, the stream of senderID, goes.
+// When receiverID names a group rather than a component, the message's
+// sid is pinned to one member; grouped reports whether that happened. dst
+// is nil if the target is offline.
+//
+// A pin lasts until the caller sends PT_CANCEL or PT_ERROR, the member
+// sends PT_CLOSE or PT_ERROR, or either side disconnects. PT_CLOSE from
+// the caller only half-closes the call, so later packages on the sid,
+// such as PT_WINDOW_UPDATE or PT_CANCEL, still reach the same member.
+func (s *Server) route(c *conn, senderID, receiverID string, msg *channel.ChannelMessage) (dst *conn, grouped bool) {
+	s.mu.RLock()
+	dst, ok := s.channels[receiverID]
+	s.mu.RUnlock()
+	if ok {
+		return dst, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, ok := s.groups[receiverID]
+	if !ok {
+		return nil, false
+	}
+
+	key := sessionKey{senderID: senderID, sid: msg.GetSid()}
+	t := msg.GetPkg().GetType()
+	sess, ok := s.sessions[key]
+	// 同一 sid 属于调用方的旧通道时，视为新会话
+	if !ok || sess.caller != c {
+		// 结束类的包不会开启新会话
+		if endsSession(t) {
+			return nil, true
+		}
+		member := g.members[g.next%len(g.members)]
+		g.next++
+		sess = &session{groupID: receiverID, caller: c, member: s.channels[member]}
+		if sess.member == nil {
+			return nil, true
+		}
+		s.sessions[key] = sess
+	}
+
+	switch t {
+	case channel.PackageType_PT_CANCEL, channel.PackageType_PT_ERROR:
+		delete(s.sessions, key)
+	}
+	return sess.member, true
+}
+
+// endsSession reports whether a package of type t can only belong to a
+// session that is already running.
+func endsSession(t channel.PackageType) bool {
+	switch t {
+	case channel.PackageType_PT_CLOSE, channel.PackageType_PT_ERROR,
+		channel.PackageType_PT_CANCEL, channel.PackageType_PT_WINDOW_UPDATE:
+		return true
+	}
+	return false
+}
+
+// endSession unpins sid of callerID if it is pinned to member.
+func (s *Server) endSession(callerID, sid string, member *conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := sessionKey{senderID: callerID, sid: sid}
+	if sess, ok := s.sessions[key]; ok && sess.member == member {
+		delete(s.sessions, key)
+	}
+}
+
+type lostSession struct {
+	caller  *conn
+	sid     string
+	groupID string
+}
+
+// endSessions drops the sessions opened by c and the sessions pinned to
+// c, and returns the callers of the latter. Sessions that a reconnected
+// stream of the same component opened are kept. The caller must hold s.mu.
+func (s *Server) endSessions(c *conn) []lostSession {
+	var lost []lostSession
+	for key, sess := range s.sessions {
+		switch {
+		case sess.caller == c:
+			delete(s.sessions, key)
+		case sess.member == c:
+			delete(s.sessions, key)
+			lost = append(lost, lostSession{caller: sess.caller, sid: key.sid, groupID: sess.groupID})
+		}
+	}
+	return lost
+}
+
+// joinGroup adds memberID to groupID. The caller must hold s.mu.
+func (s *Server) joinGroup(groupID, memberID string) {
+	g, ok := s.groups[groupID]
+	if !ok {
+		g = &group{}
+		s.groups[groupID] = g
+	}
+	if !slices.Contains(g.members, memberID) {
+		g.members = append(g.members, memberID)
+	}
+}
+
+// leaveGroup removes memberID from groupID. The caller must hold s.mu.
+func (s *Server) leaveGroup(groupID, memberID string) {
+	g, ok := s.groups[groupID]
+	if !ok {
+		return
+	}
+	g.members = slices.DeleteFunc(g.members, func(m string) bool {
+		return m == memberID
+	})
+	if len(g.members) == 0 {
+		delete(s.groups, groupID)
+	}
+}
+
+// ListComponents implements channel.ChannelServiceServer.
+func (s *Server) ListComponents(context.Context, *channel.ListComponentsRequest) (*channel.ListComponentsResponse, error) {
+	s.mu.RLock()
+	componentIDs := make([]string, 0, len(s.channels))
+	for id := range s.channels {
+		componentIDs = append(componentIDs, id)
+	}
+	s.mu.RUnlock()
+	slices.Sort(componentIDs)
+
+	return &channel.ListComponentsResponse{ComponentIds: componentIDs}, nil
+}
+
+// WatchComponents implements channel.ChannelServiceServer. It first sends an
+// ONLINE event for every registered component and a SNAPSHOT_END event, then
+// every later change. The watcher is registered before the snapshot is
+// taken, so no change between the two is lost.
+func (s *Server) WatchComponents(_ *channel.WatchComponentsRequest, stream channel.ChannelService_WatchComponentsServer) error {
+	events := make(chan *channel.WatchComponentsResponse, eventBuffer)
+
+	s.mu.Lock()
+	snapshot := make([]string, 0, len(s.channels))
+	for id := range s.channels {
+		snapshot = append(snapshot, id)
+	}
+	s.watchers[events] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.watchers, events)
+		s.mu.Unlock()
+	}()
+
+	slices.Sort(snapshot)
+	for _, id := range snapshot {
+		if err := stream.Send(newComponentEvent(channel.ComponentEventType_COMPONENT_EVENT_TYPE_ONLINE, id)); err != nil {
+			return err
+		}
+	}
+	if err := stream.Send(newComponentEvent(channel.ComponentEventType_COMPONENT_EVENT_TYPE_SNAPSHOT_END, "")); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return status.Error(codes.DataLoss, "component events lagged")
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		}
+	}
+}
+
+// publish fans a component event out to every watcher. A watcher that
+// cannot keep up is dropped. The caller must hold s.mu.
+func (s *Server) publish(eventType channel.ComponentEventType, componentID string) {
+	event := newComponentEvent(eventType, componentID)
+	for w := range s.watchers {
+		select {
+		case w <- event:
+		default:
+			delete(s.watchers, w)
+			close(w)
+		}
+	}
+}
+
+func newComponentEvent(eventType channel.ComponentEventType, componentID string) *channel.WatchComponentsResponse {
+	return &channel.WatchComponentsResponse{
+		Type:        eventType,
+		ComponentId: componentID,
+	}
+}
+
+func stampSenderID(pkg *channel.MessagePackage, senderID string) {
+	pkg.Md = slices.DeleteFunc(pkg.Md, func(e *channel.MetadataEntry) bool {
+		return e.GetKey() == SenderIDHeader
+	})
+	pkg.Md = append(pkg.Md, &channel.MetadataEntry{
+		Key:    SenderIDHeader,
+		Values: []string{senderID},
+	})
+}
+
+func newErrorNotFound(componentID string) *channel.MessagePackage {
+	st, _ := status.New(codes.Unavailable, "target service is offline or not available").WithDetails(&errdetails.ErrorInfo{
+		Reason:   ReasonComponentOffline,
+		Domain:   ErrorDomain,
+		Metadata: map[string]string{"component_id": componentID},
+	})
+	payload, _ := anypb.New(st.Proto())
+
+	return &channel.MessagePackage{
+		Type:    channel.PackageType_PT_ERROR,
+		Payload: payload,
+	}
+}
+
+func parseMetadataValue(md metadata.MD, key string) (string, error) {
+	values := md.Get(key)
+	if len(values) == 0 {
+		return "", status.Errorf(codes.InvalidArgument, "No %s in metadata", key)
+	}
+	return values[0], nil
+}
@@ -0,0 +1,481 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"grpchub-test/capture"
+	capturev1 "grpchub-test/gen/capture/v1"
+
+	channel "github.com/lisoboss/grpchub-go/gen/channel/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func startHub(t *testing.T, opts ...Option) (*Server, channel.ChannelServiceClient) {
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	hub := NewServer(opts...)
+	hub.Register(gs)
+	go func() {
+		_ = gs.Serve(lis)
+	}()
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	return hub, channel.NewChannelServiceClient(conn)
+}
+
+func openChannel(t *testing.T, hub *Server, client channel.ChannelServiceClient, senderID, receiverID string) channel.ChannelService_ChannelClient {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	ctx = metadata.AppendToOutgoingContext(ctx, senderIDKey, senderID, receiverIDKey, receiverID)
+
+	stream, err := client.Channel(ctx)
+	require.NoError(t, err)
+
+	// 等待 hub 完成注册
+	require.Eventually(t, func() bool {
+		hub.mu.RLock()
+		defer hub.mu.RUnlock()
+		_, ok := hub.channels[senderID]
+		return ok
+	}, time.Second, 10*time.Millisecond)
+
+	return stream
+}
+
+func TestHub_Relay(t *testing.T) {
+	hub, client := startHub(t)
+
+	server := openChannel(t, hub, client, "echo-server", "echo-client")
+	cli := openChannel(t, hub, client, "echo-client", "echo-server")
+
+	err := cli.Send(&channel.ChannelMessage{
+		Sid: "1",
+		Pkg: &channel.MessagePackage{
+			Type:   channel.PackageType_PT_HEADER,
+			Method: "/test.v1.TestService/UnaryCall",
+			Md: []*channel.MetadataEntry{
+				{Key: "test-header", Values: []string{"1"}},
+				// 伪造的发送方会被 hub 覆盖
+				{Key: SenderIDHeader, Values: []string{"someone-else"}},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	msg, err := server.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "1", msg.GetSid())
+	assert.Equal(t, channel.PackageType_PT_HEADER, msg.GetPkg().GetType())
+	assert.Equal(t, "/test.v1.TestService/UnaryCall", msg.GetPkg().GetMethod())
+
+	md := map[string][]string{}
+	for _, e := range msg.GetPkg().GetMd() {
+		md[e.GetKey()] = append(md[e.GetKey()], e.GetValues()...)
+	}
+	assert.Equal(t, map[string][]string{
+		"test-header":  {"1"},
+		SenderIDHeader: {"echo-client"},
+	}, md)
+}
+
+func TestHub_ReceiverOffline(t *testing.T) {
+	hub, client := startHub(t)
+
+	cli := openChannel(t, hub, client, "echo-client", "echo-server")
+	err := cli.Send(&channel.ChannelMessage{
+		Sid: "1",
+		Pkg: &channel.MessagePackage{Type: channel.PackageType_PT_HELLO},
+	})
+	require.NoError(t, err)
+
+	msg, err := cli.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "1", msg.GetSid())
+	assert.Equal(t, channel.PackageType_PT_ERROR, msg.GetPkg().GetType())
+
+	var st spb.Status
+	require.NoError(t, msg.GetPkg().GetPayload().UnmarshalTo(&st))
+	assert.Equal(t, int32(codes.Unavailable), st.GetCode())
+	assert.Equal(t, "target service is offline or not available", st.GetMessage())
+	require.Len(t, st.GetDetails(), 1)
+	var info errdetails.ErrorInfo
+	require.NoError(t, st.GetDetails()[0].UnmarshalTo(&info))
+	assert.Equal(t, ReasonComponentOffline, info.GetReason())
+	assert.Equal(t, ErrorDomain, info.GetDomain())
+	assert.Equal(t, "echo-server", info.GetMetadata()["component_id"])
+
+	_, err = cli.Recv()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestHub_MissingMetadata(t *testing.T) {
+	_, client := startHub(t)
+
+	stream, err := client.Channel(context.Background())
+	require.NoError(t, err)
+
+	_, err = stream.Recv()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "No sender_id in metadata")
+}
+
+func TestHub_Reconnect(t *testing.T) {
+	hub, client := startHub(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = metadata.AppendToOutgoingContext(ctx, senderIDKey, "echo-server", receiverIDKey, "echo-client")
+	stale, err := client.Channel(ctx)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		hub.mu.RLock()
+		defer hub.mu.RUnlock()
+		_, ok := hub.channels["echo-server"]
+		return ok
+	}, time.Second, 10*time.Millisecond)
+
+	// 重连：新通道覆盖旧注册后，旧通道断开不应把新注册删掉
+	server := openChannel(t, hub, client, "echo-server", "echo-client")
+	cancel()
+	_, err = stale.Recv()
+	require.Error(t, err)
+
+	cli := openChannel(t, hub, client, "echo-client", "echo-server")
+	err = cli.Send(&channel.ChannelMessage{
+		Sid: "1",
+		Pkg: &channel.MessagePackage{Type: channel.PackageType_PT_HELLO},
+	})
+	require.NoError(t, err)
+
+	msg, err := server.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, channel.PackageType_PT_HELLO, msg.GetPkg().GetType())
+}
+
+func TestHub_ListComponents(t *testing.T) {
+	hub, client := startHub(t)
+
+	openChannel(t, hub, client, "echo-server", "echo-client")
+	openChannel(t, hub, client, "echo-client", "echo-server")
+
+	resp, err := client.ListComponents(context.Background(), &channel.ListComponentsRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"echo-client", "echo-server"}, resp.GetComponentIds())
+}
+
+func TestHub_WatchComponents(t *testing.T) {
+	hub, client := startHub(t)
+
+	openChannel(t, hub, client, "echo-server", "echo-client")
+
+	watch, err := client.WatchComponents(context.Background(), &channel.WatchComponentsRequest{})
+	require.NoError(t, err)
+
+	event, err := watch.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, channel.ComponentEventType_COMPONENT_EVENT_TYPE_ONLINE, event.GetType())
+	assert.Equal(t, "echo-server", event.GetComponentId())
+	event, err = watch.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, channel.ComponentEventType_COMPONENT_EVENT_TYPE_SNAPSHOT_END, event.GetType())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = metadata.AppendToOutgoingContext(ctx, senderIDKey, "echo-client", receiverIDKey, "echo-server")
+	_, err = client.Channel(ctx)
+	require.NoError(t, err)
+
+	event, err = watch.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, channel.ComponentEventType_COMPONENT_EVENT_TYPE_ONLINE, event.GetType())
+	assert.Equal(t, "echo-client", event.GetComponentId())
+
+	cancel()
+
+	event, err = watch.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, channel.ComponentEventType_COMPONENT_EVENT_TYPE_OFFLINE, event.GetType())
+	assert.Equal(t, "echo-client", event.GetComponentId())
+}
+
+// openReplica connects memberID as a replica of groupID that replies to
+// receiverID.
+func openReplica(t *testing.T, hub *Server, client channel.ChannelServiceClient, memberID, groupID, receiverID string) (channel.ChannelService_ChannelClient, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	ctx = metadata.AppendToOutgoingContext(ctx,
+		senderIDKey, memberID,
+		receiverIDKey, receiverID,
+		groupIDKey, groupID,
+	)
+	stream, err := client.Channel(ctx)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		hub.mu.RLock()
+		defer hub.mu.RUnlock()
+		g, ok := hub.groups[groupID]
+		return ok && slices.Contains(g.members, memberID)
+	}, time.Second, 10*time.Millisecond)
+	return stream, cancel
+}
+
+func sendPkg(t *testing.T, stream channel.ChannelService_ChannelClient, sid string, pt channel.PackageType) {
+	err := stream.Send(&channel.ChannelMessage{Sid: sid, Pkg: &channel.MessagePackage{Type: pt}})
+	require.NoError(t, err)
+}
+
+func recvPkg(t *testing.T, stream channel.ChannelService_ChannelClient, sid string, pt channel.PackageType) *channel.ChannelMessage {
+	msg, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, sid, msg.GetSid())
+	assert.Equal(t, pt, msg.GetPkg().GetType())
+	return msg
+}
+
+func TestHub_Group(t *testing.T) {
+	hub, client := startHub(t)
+
+	replica1, _ := openReplica(t, hub, client, "echo-server-1", "echo-server", "echo-client")
+	replica2, stop2 := openReplica(t, hub, client, "echo-server-2", "echo-server", "echo-client")
+	cli := openChannel(t, hub, client, "echo-client", "echo-server")
+
+	// 新 sid 轮询分配，同一 sid 粘在同一副本上
+	sendPkg(t, cli, "1", channel.PackageType_PT_HEADER)
+	sendPkg(t, cli, "2", channel.PackageType_PT_HEADER)
+	sendPkg(t, cli, "1", channel.PackageType_PT_PAYLOAD)
+	sendPkg(t, cli, "2", channel.PackageType_PT_CLOSE)
+
+	recvPkg(t, replica1, "1", channel.PackageType_PT_HEADER)
+	recvPkg(t, replica1, "1", channel.PackageType_PT_PAYLOAD)
+	recvPkg(t, replica2, "2", channel.PackageType_PT_HEADER)
+	recvPkg(t, replica2, "2", channel.PackageType_PT_CLOSE)
+
+	// 副本的回复直接发往客户端
+	sendPkg(t, replica2, "2", channel.PackageType_PT_PAYLOAD)
+	recvPkg(t, cli, "2", channel.PackageType_PT_PAYLOAD)
+
+	// 调用方的 PT_CLOSE 只是半关闭，之后的包仍发往同一副本，直到 PT_CANCEL
+	sendPkg(t, cli, "1", channel.PackageType_PT_CLOSE)
+	sendPkg(t, cli, "1", channel.PackageType_PT_WINDOW_UPDATE)
+	sendPkg(t, cli, "1", channel.PackageType_PT_CANCEL)
+	recvPkg(t, replica1, "1", channel.PackageType_PT_CLOSE)
+	recvPkg(t, replica1, "1", channel.PackageType_PT_WINDOW_UPDATE)
+	recvPkg(t, replica1, "1", channel.PackageType_PT_CANCEL)
+
+	// 副本结束会话后解除绑定；迟到的包被丢弃，不会发往其他副本
+	sendPkg(t, replica2, "2", channel.PackageType_PT_CLOSE)
+	recvPkg(t, cli, "2", channel.PackageType_PT_CLOSE)
+	sendPkg(t, cli, "1", channel.PackageType_PT_WINDOW_UPDATE)
+	sendPkg(t, cli, "2", channel.PackageType_PT_WINDOW_UPDATE)
+	sendPkg(t, cli, "3", channel.PackageType_PT_HEADER)
+	sendPkg(t, cli, "4", channel.PackageType_PT_HEADER)
+	recvPkg(t, replica1, "3", channel.PackageType_PT_HEADER)
+	recvPkg(t, replica2, "4", channel.PackageType_PT_HEADER)
+
+	// 副本断开时，绑定在它上面的会话收到 UNAVAILABLE
+	stop2()
+	msg := recvPkg(t, cli, "4", channel.PackageType_PT_ERROR)
+	var st spb.Status
+	require.NoError(t, msg.GetPkg().GetPayload().UnmarshalTo(&st))
+	assert.Equal(t, int32(codes.Unavailable), st.GetCode())
+
+	// 其他会话不受影响
+	sendPkg(t, cli, "3", channel.PackageType_PT_PAYLOAD)
+	recvPkg(t, replica1, "3", channel.PackageType_PT_PAYLOAD)
+
+	resp, err := client.ListComponents(context.Background(), &channel.ListComponentsRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"echo-client", "echo-server-1"}, resp.GetComponentIds())
+}
+
+func TestHub_GroupRoundRobin(t *testing.T) {
+	hub, client := startHub(t)
+
+	a1, _ := openReplica(t, hub, client, "a-1", "a", "client-a")
+	a2, _ := openReplica(t, hub, client, "a-2", "a", "client-a")
+	b1, _ := openReplica(t, hub, client, "b-1", "b", "client-b")
+	b2, _ := openReplica(t, hub, client, "b-2", "b", "client-b")
+	cliA := openChannel(t, hub, client, "client-a", "a")
+	cliB := openChannel(t, hub, client, "client-b", "b")
+
+	// 两个组交替调用时，各组独立轮询
+	sendPkg(t, cliA, "1", channel.PackageType_PT_HEADER)
+	recvPkg(t, a1, "1", channel.PackageType_PT_HEADER)
+	sendPkg(t, cliB, "1", channel.PackageType_PT_HEADER)
+	recvPkg(t, b1, "1", channel.PackageType_PT_HEADER)
+	sendPkg(t, cliA, "2", channel.PackageType_PT_HEADER)
+	recvPkg(t, a2, "2", channel.PackageType_PT_HEADER)
+	sendPkg(t, cliB, "2", channel.PackageType_PT_HEADER)
+	recvPkg(t, b2, "2", channel.PackageType_PT_HEADER)
+}
+
+func TestHub_GroupCallerReconnect(t *testing.T) {
+	hub, client := startHub(t)
+
+	replica1, _ := openReplica(t, hub, client, "echo-server-1", "echo-server", "echo-client")
+	replica2, _ := openReplica(t, hub, client, "echo-server-2", "echo-server", "echo-client")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = metadata.AppendToOutgoingContext(ctx, senderIDKey, "echo-client", receiverIDKey, "echo-server")
+	stale, err := client.Channel(ctx)
+	require.NoError(t, err)
+	sendPkg(t, stale, "2", channel.PackageType_PT_HEADER)
+	sendPkg(t, stale, "1", channel.PackageType_PT_HEADER)
+	recvPkg(t, replica1, "2", channel.PackageType_PT_HEADER)
+	recvPkg(t, replica2, "1", channel.PackageType_PT_HEADER)
+
+	// 重连后的新通道从头编号 sid，不能沿用旧通道的会话
+	cli := openChannel(t, hub, client, "echo-client", "echo-server")
+	sendPkg(t, cli, "1", channel.PackageType_PT_HEADER)
+	recvPkg(t, replica1, "1", channel.PackageType_PT_HEADER)
+
+	// 旧通道断开只结束它自己的会话
+	cancel()
+	_, err = stale.Recv()
+	require.Error(t, err)
+	require.Eventually(t, func() bool {
+		hub.mu.RLock()
+		defer hub.mu.RUnlock()
+		_, ok := hub.sessions[sessionKey{senderID: "echo-client", sid: "2"}]
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+
+	sendPkg(t, cli, "1", channel.PackageType_PT_PAYLOAD)
+	sendPkg(t, cli, "3", channel.PackageType_PT_HEADER)
+	recvPkg(t, replica1, "1", channel.PackageType_PT_PAYLOAD)
+	recvPkg(t, replica2, "3", channel.PackageType_PT_HEADER)
+}
+
+func TestHub_CaptureReplay(t *testing.T) {
+	var buf bytes.Buffer
+	w := capture.NewWriter(&buf)
+	hub, client := startHub(t, WithCapture(w))
+
+	server := openChannel(t, hub, client, "echo-server", "echo-client")
+	cli := openChannel(t, hub, client, "echo-client", "echo-server")
+
+	call := []*channel.ChannelMessage{
+		{Sid: "1", Pkg: &channel.MessagePackage{Type: channel.PackageType_PT_HEADER, Method: "/test.v1.TestService/UnaryCall"}},
+		{Sid: "1", Pkg: &channel.MessagePackage{Type: channel.PackageType_PT_PAYLOAD}},
+	}
+	for _, msg := range call {
+		require.NoError(t, cli.Send(msg))
+		_, err := server.Recv()
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Flush())
+
+	// 每个包各记录一次入站和一次出站
+	r := capture.NewReader(bytes.NewReader(buf.Bytes()))
+	var dirs []capturev1.Direction
+	for {
+		rec, msg, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		assert.Equal(t, "1", msg.GetSid())
+		dirs = append(dirs, rec.GetDirection())
+		if rec.GetDirection() == capturev1.Direction_DIRECTION_INBOUND {
+			assert.Equal(t, "echo-client", rec.GetComponentId())
+			assert.Equal(t, "echo-server", rec.GetReceiverId())
+		} else {
+			assert.Equal(t, "echo-server", rec.GetComponentId())
+		}
+	}
+	assert.ElementsMatch(t, []capturev1.Direction{
+		capturev1.Direction_DIRECTION_INBOUND, capturev1.Direction_DIRECTION_OUTBOUND,
+		capturev1.Direction_DIRECTION_INBOUND, capturev1.Direction_DIRECTION_OUTBOUND,
+	}, dirs)
+
+	var out strings.Builder
+	require.NoError(t, capture.Print(&out, capture.NewReader(bytes.NewReader(buf.Bytes())), nil))
+	assert.Contains(t, out.String(), "echo-client => hub (echo-server)  sid=1  PT_HEADER  /test.v1.TestService/UnaryCall")
+	assert.Contains(t, out.String(), "hub => echo-server  sid=1  PT_PAYLOAD")
+
+	// 重放客户端发出的包，服务端应收到同样的内容
+	receiverID, msgs, err := capture.Session(capture.NewReader(bytes.NewReader(buf.Bytes())), "echo-client")
+	require.NoError(t, err)
+	assert.Equal(t, "echo-server", receiverID)
+
+	// 原组件在线时拒绝重放
+	err = capture.Replay(context.Background(), client, "echo-client", receiverID, msgs, nil)
+	require.ErrorIs(t, err, capture.ErrComponentOnline)
+
+	offline := func() {
+		require.Eventually(t, func() bool {
+			resp, err := client.ListComponents(context.Background(), &channel.ListComponentsRequest{})
+			return err == nil && !slices.Contains(resp.GetComponentIds(), "echo-client")
+		}, time.Second, 10*time.Millisecond)
+	}
+
+	// 原组件下线后以其身份重放，回复发往重放方
+	require.NoError(t, cli.CloseSend())
+	offline()
+
+	var replies []*channel.ChannelMessage
+	replayed := make(chan error, 1)
+	go func() {
+		replayed <- capture.Replay(context.Background(), client, "echo-client", receiverID, msgs, func(msg *channel.ChannelMessage) {
+			replies = append(replies, msg)
+		})
+	}()
+	for _, want := range call {
+		msg, err := server.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, want.GetPkg().GetType(), msg.GetPkg().GetType())
+		assert.Equal(t, want.GetPkg().GetMethod(), msg.GetPkg().GetMethod())
+	}
+	require.NoError(t, server.Send(&channel.ChannelMessage{Sid: "1", Pkg: &channel.MessagePackage{Type: channel.PackageType_PT_CLOSE}}))
+
+	select {
+	case err := <-replayed:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("replay did not finish after PT_CLOSE")
+	}
+	require.Len(t, replies, 1)
+	assert.Equal(t, channel.PackageType_PT_CLOSE, replies[0].GetPkg().GetType())
+
+	// 不关心回复时 onRecv 可以为 nil
+	offline()
+	go func() {
+		replayed <- capture.Replay(context.Background(), client, "echo-client", receiverID, msgs, nil)
+	}()
+	for range call {
+		_, err := server.Recv()
+		require.NoError(t, err)
+	}
+	require.NoError(t, server.Send(&channel.ChannelMessage{Sid: "1", Pkg: &channel.MessagePackage{Type: channel.PackageType_PT_CLOSE}}))
+	select {
+	case err := <-replayed:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("replay did not finish after PT_CLOSE")
+	}
+}
@@ -0,0 +1,70 @@
+package hub
+
+import (
+	"context"
+	"crypto/x509"
+	"slices"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// IdentityVerifier decides whether the caller behind ctx may register as
+// componentID, either as its sender_id or as the group_id it joins. A
+// non-nil error rejects the Channel stream and is returned to the caller.
+//
+// Verifiers that check a signed token instead of a certificate can read
+// it from metadata.FromIncomingContext(ctx).
+type IdentityVerifier func(ctx context.Context, componentID string) error
+
+// WithIdentityVerifier makes the hub check sender_id and group_id with v
+// before registering a Channel stream. Without it any authenticated client
+// may register under any component ID.
+func WithIdentityVerifier(v IdentityVerifier) Option {
+	return func(s *Server) {
+		s.verifier = v
+	}
+}
+
+// VerifyPeerCertificate is an IdentityVerifier that accepts componentID
+// only if it equals the subject CN, a DNS SAN or a URI SAN of the client
+// certificate verified during the mTLS handshake.
+func VerifyPeerCertificate(ctx context.Context, componentID string) error {
+	cert, err := verifiedPeerCertificate(ctx)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(certificateIdentities(cert), componentID) {
+		return status.Errorf(codes.PermissionDenied, "component %q does not match the client certificate", componentID)
+	}
+	return nil
+}
+
+func verifiedPeerCertificate(ctx context.Context) (*x509.Certificate, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "No peer in context")
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Connection is not TLS")
+	}
+	if len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "No verified client certificate")
+	}
+	return info.State.VerifiedChains[0][0], nil
+}
+
+func certificateIdentities(cert *x509.Certificate) []string {
+	ids := make([]string, 0, 1+len(cert.DNSNames)+len(cert.URIs))
+	if cert.Subject.CommonName != "" {
+		ids = append(ids, cert.Subject.CommonName)
+	}
+	ids = append(ids, cert.DNSNames...)
+	for _, u := range cert.URIs {
+		ids = append(ids, u.String())
+	}
+	return ids
+}
@@ -0,0 +1,138 @@
+package hub
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	channel "github.com/lisoboss/grpchub-go/gen/channel/v1"
+	"github.com/lisoboss/grpchub/grpchub-go-contrib/certs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// startTLSHub starts a hub that verifies identities with
+// VerifyPeerCertificate behind mTLS and connects to it with clientCert, or
+// without a client certificate if it is nil.
+func startTLSHub(t *testing.T, ca *certs.CA, clientCert *certs.Certificate) (*Server, channel.ChannelServiceClient) {
+	serverCert, err := ca.IssueServer(certs.DefaultHosts, certs.WithECDSAKey())
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Cert)
+
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{serverCert.TLSCertificate()},
+		ClientCAs:    pool,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	})))
+	hub := NewServer(WithIdentityVerifier(VerifyPeerCertificate))
+	hub.Register(gs)
+	go func() {
+		_ = gs.Serve(lis)
+	}()
+	t.Cleanup(gs.Stop)
+
+	clientTLS := &tls.Config{RootCAs: pool, ServerName: "localhost"}
+	if clientCert != nil {
+		clientTLS.Certificates = []tls.Certificate{clientCert.TLSCertificate()}
+	}
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(credentials.NewTLS(clientTLS)),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	return hub, channel.NewChannelServiceClient(conn)
+}
+
+// registerCode opens a Channel stream with the metadata kv and returns
+// the code it ends with, DeadlineExceeded if the hub accepted it.
+func registerCode(t *testing.T, client channel.ChannelServiceClient, kv ...string) codes.Code {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	stream, err := client.Channel(metadata.AppendToOutgoingContext(ctx, kv...))
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	return status.Code(err)
+}
+
+func TestVerifyPeerCertificate(t *testing.T) {
+	ca, err := certs.NewCA(certs.WithECDSAKey())
+	require.NoError(t, err)
+	cert, err := ca.IssueComponent("echo-server", time.Hour)
+	require.NoError(t, err)
+
+	hub, client := startTLSHub(t, ca, cert)
+	openChannel(t, hub, client, "echo-server", "echo-client")
+
+	assert.Equal(t, codes.PermissionDenied, registerCode(t, client,
+		senderIDKey, "echo-client", receiverIDKey, "echo-server"))
+	assert.Equal(t, codes.PermissionDenied, registerCode(t, client,
+		senderIDKey, "echo-server", receiverIDKey, "echo-client", groupIDKey, "payments"))
+
+	// 其他 CA 签发的证书在握手时被拒绝
+	other, err := certs.NewCA(certs.WithECDSAKey())
+	require.NoError(t, err)
+	forged, err := other.IssueComponent("echo-server", time.Hour)
+	require.NoError(t, err)
+	_, client = startTLSHub(t, ca, forged)
+	_, err = client.ListComponents(context.Background(), &channel.ListComponentsRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	_, client = startTLSHub(t, ca, nil)
+	assert.Equal(t, codes.Unauthenticated, registerCode(t, client,
+		senderIDKey, "echo-server", receiverIDKey, "echo-client"))
+
+	_, client = startHub(t, WithIdentityVerifier(VerifyPeerCertificate))
+	assert.Equal(t, codes.Unauthenticated, registerCode(t, client,
+		senderIDKey, "echo-server", receiverIDKey, "echo-client"))
+}
+
+func TestCertificateIdentities(t *testing.T) {
+	cert := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "echo-server"},
+		DNSNames: []string{"echo-server-1"},
+		URIs:     []*url.URL{{Scheme: "spiffe", Host: "grpchub", Path: "/echo-server-2"}},
+	}
+	assert.Equal(t, []string{"echo-server", "echo-server-1", "spiffe://grpchub/echo-server-2"}, certificateIdentities(cert))
+}
+
+func TestHub_IdentityVerifier(t *testing.T) {
+	hub, client := startHub(t, WithIdentityVerifier(func(_ context.Context, componentID string) error {
+		if componentID != "echo-server" {
+			return status.Errorf(codes.PermissionDenied, "component %q not allowed", componentID)
+		}
+		return nil
+	}))
+
+	openChannel(t, hub, client, "echo-server", "echo-client")
+
+	// 冒充其他组件的注册被拒绝
+	assert.Equal(t, codes.PermissionDenied, registerCode(t, client,
+		senderIDKey, "echo-client", receiverIDKey, "echo-server"))
+
+	// 加入未授权的组同样被拒绝
+	assert.Equal(t, codes.PermissionDenied, registerCode(t, client,
+		senderIDKey, "echo-server", receiverIDKey, "echo-client", groupIDKey, "payments"))
+
+	resp, err := client.ListComponents(context.Background(), &channel.ListComponentsRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"echo-server"}, resp.GetComponentIds())
+}
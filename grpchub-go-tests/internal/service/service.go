@@ -10,14 +10,24 @@ import (
 
 	testpb "grpchub-test/gen/test"
 
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+const (
+	// ErrorDomain ErrorCall 返回的 ErrorInfo.domain
+	ErrorDomain = "grpchub-test"
+	// RetryDelay ErrorCall 返回的 RetryInfo.retry_delay
+	RetryDelay = time.Second
+)
+
 // TestService 实现所有测试服务方法
 type TestService struct {
 	testpb.UnimplementedTestServiceServer
@@ -162,23 +172,35 @@ func (s *TestService) EmptyCall(ctx context.Context, req *emptypb.Empty) (*empty
 	return &emptypb.Empty{}, nil
 }
 
-// ErrorCall 错误测试实现
+// ErrorCall 错误测试实现，每个错误都带 ErrorInfo，部分带 BadRequest 或 RetryInfo
 func (s *TestService) ErrorCall(ctx context.Context, req *testpb.ErrorRequest) (*testpb.ErrorResponse, error) {
+	info := &errdetails.ErrorInfo{
+		Reason: req.ErrorType.String(),
+		Domain: ErrorDomain,
+	}
+	retry := &errdetails.RetryInfo{
+		RetryDelay: durationpb.New(RetryDelay),
+	}
+
 	switch req.ErrorType {
 	case testpb.ErrorType_ERROR_TYPE_INVALID_ARGUMENT:
-		return nil, status.Error(codes.InvalidArgument, "Invalid argument: "+req.Message)
+		return nil, errorWithDetails(codes.InvalidArgument, "Invalid argument: "+req.Message, info, &errdetails.BadRequest{
+			FieldViolations: []*errdetails.BadRequest_FieldViolation{
+				{Field: "message", Description: req.Message},
+			},
+		})
 	case testpb.ErrorType_ERROR_TYPE_NOT_FOUND:
-		return nil, status.Error(codes.NotFound, "Not found: "+req.Message)
+		return nil, errorWithDetails(codes.NotFound, "Not found: "+req.Message, info)
 	case testpb.ErrorType_ERROR_TYPE_PERMISSION_DENIED:
-		return nil, status.Error(codes.PermissionDenied, "Permission denied: "+req.Message)
+		return nil, errorWithDetails(codes.PermissionDenied, "Permission denied: "+req.Message, info)
 	case testpb.ErrorType_ERROR_TYPE_RESOURCE_EXHAUSTED:
-		return nil, status.Error(codes.ResourceExhausted, "Resource exhausted: "+req.Message)
+		return nil, errorWithDetails(codes.ResourceExhausted, "Resource exhausted: "+req.Message, info, retry)
 	case testpb.ErrorType_ERROR_TYPE_INTERNAL:
-		return nil, status.Error(codes.Internal, "Internal error: "+req.Message)
+		return nil, errorWithDetails(codes.Internal, "Internal error: "+req.Message, info)
 	case testpb.ErrorType_ERROR_TYPE_UNAVAILABLE:
-		return nil, status.Error(codes.Unavailable, "Service unavailable: "+req.Message)
+		return nil, errorWithDetails(codes.Unavailable, "Service unavailable: "+req.Message, info, retry)
 	case testpb.ErrorType_ERROR_TYPE_DEADLINE_EXCEEDED:
-		return nil, status.Error(codes.DeadlineExceeded, "Deadline exceeded: "+req.Message)
+		return nil, errorWithDetails(codes.DeadlineExceeded, "Deadline exceeded: "+req.Message, info)
 	default:
 		return &testpb.ErrorResponse{
 			Result: "No error",
@@ -186,6 +208,14 @@ func (s *TestService) ErrorCall(ctx context.Context, req *testpb.ErrorRequest) (
 	}
 }
 
+func errorWithDetails(c codes.Code, msg string, details ...protoadapt.MessageV1) error {
+	st, err := status.New(c, msg).WithDetails(details...)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return st.Err()
+}
+
 // LargeDataCall 大数据测试实现
 func (s *TestService) LargeDataCall(ctx context.Context, req *testpb.LargeDataRequest) (*testpb.LargeDataResponse, error) {
 	originalSize := len(req.Data)
@@ -0,0 +1,187 @@
+// Package kratosx runs hub-backed servers inside a Kratos app and looks up
+// hub components through a Kratos registry.Discovery.
+//
+//	srv, _ := grpcx.NewServer("echo-server", ghc)
+//	app := kratos.New(kratos.Server(kratosx.NewServer("echo-server", srv)))
+package kratosx
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"sync"
+
+	"github.com/go-kratos/kratos/v2/registry"
+	"github.com/go-kratos/kratos/v2/transport"
+	channel "github.com/lisoboss/grpchub-go/gen/channel/v1"
+)
+
+// Scheme is the URL scheme of hub component endpoints, as in
+// hub:///echo-server.
+const Scheme = "hub"
+
+var (
+	_ transport.Server     = (*Server)(nil)
+	_ transport.Endpointer = (*Server)(nil)
+	_ registry.Discovery   = (*Discovery)(nil)
+)
+
+// Servable is the part of *grpcx.Server that Server drives.
+type Servable interface {
+	Serve() error
+	Stop()
+}
+
+// Server adapts a hub-backed server to transport.Server, so a Kratos app
+// starts and stops it with the rest of its servers.
+type Server struct {
+	componentID string
+	srv         Servable
+}
+
+// NewServer wraps srv, which is registered on the hub as componentID.
+func NewServer(componentID string, srv Servable) *Server {
+	return &Server{componentID: componentID, srv: srv}
+}
+
+// Start serves until Stop is called.
+func (s *Server) Start(context.Context) error {
+	return s.srv.Serve()
+}
+
+// Stop stops the server, or returns ctx.Err() if that takes longer than
+// ctx allows.
+func (s *Server) Stop(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.srv.Stop()
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Endpoint returns hub:///<componentID>.
+func (s *Server) Endpoint() (*url.URL, error) {
+	return endpoint(s.componentID), nil
+}
+
+func endpoint(componentID string) *url.URL {
+	return &url.URL{Scheme: Scheme, Path: "/" + componentID}
+}
+
+// Discovery implements registry.Discovery with the hub's ListComponents
+// and WatchComponents RPCs. A service name is a component ID; a component
+// that is online has one instance whose endpoint is hub:///<componentID>.
+// Component groups are not listed by the hub, so a group name has no
+// instances.
+type Discovery struct {
+	client channel.ChannelServiceClient
+}
+
+// NewDiscovery returns a Discovery that asks the hub behind client.
+func NewDiscovery(client channel.ChannelServiceClient) *Discovery {
+	return &Discovery{client: client}
+}
+
+// GetService returns the instance of serviceName if it is online.
+func (d *Discovery) GetService(ctx context.Context, serviceName string) ([]*registry.ServiceInstance, error) {
+	resp, err := d.client.ListComponents(ctx, &channel.ListComponentsRequest{})
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range resp.GetComponentIds() {
+		if id == serviceName {
+			return instances(serviceName, true), nil
+		}
+	}
+	return instances(serviceName, false), nil
+}
+
+// Watch follows serviceName. The first Next returns its current
+// instances; later calls block until it goes online or offline.
+func (d *Discovery) Watch(ctx context.Context, serviceName string) (registry.Watcher, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := d.client.WatchComponents(ctx, &channel.WatchComponentsRequest{})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &watcher{
+		name:   serviceName,
+		stream: stream,
+		cancel: cancel,
+		first:  true,
+	}, nil
+}
+
+// watcher turns component events into instance lists. Its state comes
+// only from the stream: WatchComponents starts with an ONLINE event per
+// registered component and a SNAPSHOT_END event, and the hub registers the
+// watcher before taking that snapshot, so no change is lost between the
+// two.
+type watcher struct {
+	name   string
+	stream channel.ChannelService_WatchComponentsClient
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	first  bool
+	online bool
+}
+
+func (w *watcher) Next() ([]*registry.ServiceInstance, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for {
+		event, err := w.stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("hub closed the component watch")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch event.GetType() {
+		case channel.ComponentEventType_COMPONENT_EVENT_TYPE_SNAPSHOT_END:
+			if w.first {
+				w.first = false
+				return instances(w.name, w.online), nil
+			}
+		case channel.ComponentEventType_COMPONENT_EVENT_TYPE_ONLINE, channel.ComponentEventType_COMPONENT_EVENT_TYPE_OFFLINE:
+			if event.GetComponentId() != w.name {
+				continue
+			}
+			online := event.GetType() == channel.ComponentEventType_COMPONENT_EVENT_TYPE_ONLINE
+			// 快照结束前只记录状态，由 SNAPSHOT_END 一次性返回
+			if online != w.online {
+				w.online = online
+				if !w.first {
+					return instances(w.name, w.online), nil
+				}
+			}
+		}
+	}
+}
+
+func (w *watcher) Stop() error {
+	w.cancel()
+	return nil
+}
+
+func instances(componentID string, online bool) []*registry.ServiceInstance {
+	if !online {
+		return []*registry.ServiceInstance{}
+	}
+	return []*registry.ServiceInstance{{
+		ID:        componentID,
+		Name:      componentID,
+		Endpoints: []string{endpoint(componentID).String()},
+	}}
+}
@@ -0,0 +1,143 @@
+package kratosx
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"grpchub-test/hub"
+
+	channel "github.com/lisoboss/grpchub-go/gen/channel/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type fakeServer struct {
+	stop chan struct{}
+}
+
+func (s *fakeServer) Serve() error {
+	<-s.stop
+	return nil
+}
+
+func (s *fakeServer) Stop() {
+	close(s.stop)
+}
+
+func TestServer(t *testing.T) {
+	srv := NewServer("echo-server", &fakeServer{stop: make(chan struct{})})
+
+	u, err := srv.Endpoint()
+	require.NoError(t, err)
+	assert.Equal(t, "hub:///echo-server", u.String())
+
+	started := make(chan error, 1)
+	go func() {
+		started <- srv.Start(context.Background())
+	}()
+	require.NoError(t, srv.Stop(context.Background()))
+	select {
+	case err := <-started:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Start did not return after Stop")
+	}
+}
+
+func startHub(t *testing.T) channel.ChannelServiceClient {
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	hub.NewServer().Register(gs)
+	go func() {
+		_ = gs.Serve(lis)
+	}()
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return channel.NewChannelServiceClient(conn)
+}
+
+func register(t *testing.T, client channel.ChannelServiceClient, componentID string) context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	ctx = metadata.AppendToOutgoingContext(ctx, "sender_id", componentID, "receiver_id", "echo-client")
+	_, err := client.Channel(ctx)
+	require.NoError(t, err)
+	return cancel
+}
+
+func TestDiscovery(t *testing.T) {
+	client := startHub(t)
+	d := NewDiscovery(client)
+	ctx := context.Background()
+
+	got, err := d.GetService(ctx, "echo-server")
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	w, err := d.Watch(ctx, "echo-server")
+	require.NoError(t, err)
+	defer w.Stop()
+
+	// 第一次 Next 立即返回当前状态
+	got, err = w.Next()
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	register(t, client, "other")
+	unregister := register(t, client, "echo-server")
+
+	got, err = w.Next()
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, "echo-server", got[0].Name)
+	assert.Equal(t, []string{"hub:///echo-server"}, got[0].Endpoints)
+
+	got, err = d.GetService(ctx, "echo-server")
+	require.NoError(t, err)
+	assert.Len(t, got, 1)
+
+	unregister()
+	got, err = w.Next()
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestDiscovery_WatchOnline(t *testing.T) {
+	client := startHub(t)
+	d := NewDiscovery(client)
+	unregister := register(t, client, "echo-server")
+	require.Eventually(t, func() bool {
+		got, err := d.GetService(context.Background(), "echo-server")
+		return err == nil && len(got) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	w, err := d.Watch(context.Background(), "echo-server")
+	require.NoError(t, err)
+	defer w.Stop()
+
+	// 第一次 Next 来自快照
+	got, err := w.Next()
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+
+	unregister()
+	got, err = w.Next()
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
@@ -43,6 +43,24 @@ func Auth(token string) middleware.Middleware {
 	}
 }
 
+// HandlerDone reports why a server handler's context ended, so a test can
+// check that a client deadline or cancellation reached the remote side.
+// Handlers that finish before their context ends report nothing.
+func HandlerDone(errs chan<- error) middleware.Middleware {
+	return func(next middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (resp any, err error) {
+			resp, err = next(ctx, req)
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				select {
+				case errs <- ctxErr:
+				default:
+				}
+			}
+			return resp, err
+		}
+	}
+}
+
 func WithStreamAuth(token string) middleware.StreamTransportMiddleware {
 	return func(next middleware.StreamTransportHandler) middleware.StreamTransportHandler {
 		return func(ctx context.Context) error {
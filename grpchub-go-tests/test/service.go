@@ -4,11 +4,20 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	testpb "grpchub-test/gen/test"
+	"grpchub-test/internal/service"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -35,14 +44,61 @@ func UnaryCall(t *testing.T, client testpb.TestServiceClient) {
 }
 func ErrorCall(t *testing.T, client testpb.TestServiceClient) {
 	ctx := context.Background()
-	req := &testpb.ErrorRequest{
-		ErrorType: testpb.ErrorType_ERROR_TYPE_NOT_FOUND,
-		Message:   "ErrorRequest",
+	retry := &errdetails.RetryInfo{
+		RetryDelay: durationpb.New(service.RetryDelay),
+	}
+	cases := []struct {
+		errorType testpb.ErrorType
+		code      codes.Code
+		desc      string
+		details   []proto.Message
+	}{
+		{testpb.ErrorType_ERROR_TYPE_INVALID_ARGUMENT, codes.InvalidArgument, "Invalid argument", []proto.Message{
+			&errdetails.BadRequest{
+				FieldViolations: []*errdetails.BadRequest_FieldViolation{
+					{Field: "message", Description: "ErrorRequest"},
+				},
+			},
+		}},
+		{testpb.ErrorType_ERROR_TYPE_NOT_FOUND, codes.NotFound, "Not found", nil},
+		{testpb.ErrorType_ERROR_TYPE_PERMISSION_DENIED, codes.PermissionDenied, "Permission denied", nil},
+		{testpb.ErrorType_ERROR_TYPE_RESOURCE_EXHAUSTED, codes.ResourceExhausted, "Resource exhausted", []proto.Message{retry}},
+		{testpb.ErrorType_ERROR_TYPE_INTERNAL, codes.Internal, "Internal error", nil},
+		{testpb.ErrorType_ERROR_TYPE_UNAVAILABLE, codes.Unavailable, "Service unavailable", []proto.Message{retry}},
+		{testpb.ErrorType_ERROR_TYPE_DEADLINE_EXCEEDED, codes.DeadlineExceeded, "Deadline exceeded", nil},
+	}
+
+	for _, c := range cases {
+		req := &testpb.ErrorRequest{
+			ErrorType: c.errorType,
+			Message:   "ErrorRequest",
+		}
+		_, err := client.ErrorCall(ctx, req)
+		require.Error(t, err)
+
+		assert.Equal(t, err.Error(), fmt.Sprintf("rpc error: code = %s desc = %s: %s", c.code, c.desc, req.Message))
+
+		// 完整的 google.rpc.Status，包括 details
+		details := status.Convert(err).Details()
+		want := append([]proto.Message{&errdetails.ErrorInfo{
+			Reason: c.errorType.String(),
+			Domain: service.ErrorDomain,
+		}}, c.details...)
+		require.Len(t, details, len(want), c.errorType.String())
+		for i, d := range details {
+			got, ok := d.(proto.Message)
+			require.True(t, ok, "%s: detail %d is %v", c.errorType, i, d)
+			assert.True(t, proto.Equal(got, want[i]), "%s: detail %d is %v, want %v", c.errorType, i, got, want[i])
+		}
 	}
-	_, err := client.ErrorCall(ctx, req)
-	require.Error(t, err)
 
-	assert.Equal(t, err.Error(), fmt.Sprintf("rpc error: code = NotFound desc = Not found: %s", req.Message))
+	resp, err := client.ErrorCall(ctx, &testpb.ErrorRequest{
+		ErrorType: testpb.ErrorType_ERROR_TYPE_NONE,
+		Message:   "ErrorRequest",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, resp.Result, "No error")
 }
 func ClientStream(t *testing.T, client testpb.TestServiceClient) {}
 func ServerStream(t *testing.T, client testpb.TestServiceClient) {}
@@ -103,8 +159,63 @@ func BidirectionalStream(t *testing.T, client testpb.TestServiceClient, ctx cont
 	assert.Equal(t, reply.Echo, fmt.Sprintf("Echo: %s", reqs[int(reply.RequestId)].Message))
 }
 func LargeDataCall(t *testing.T, client testpb.TestServiceClient) {}
-func TimeoutCall(t *testing.T, client testpb.TestServiceClient)   {}
-func MetadataCall(t *testing.T, client testpb.TestServiceClient)  {}
+func TimeoutCall(t *testing.T, client testpb.TestServiceClient) {
+	req := &testpb.TimeoutRequest{
+		DelaySeconds: 0,
+		Message:      "TimeoutRequest",
+	}
+	resp, err := client.TimeoutCall(context.Background(), req)
+	require.NoError(t, err)
+
+	assert.Equal(t, resp.Result, fmt.Sprintf("Completed after %d seconds: %s", req.DelaySeconds, req.Message))
+	assert.Equal(t, resp.ActualDelay, req.DelaySeconds)
+
+	// 客户端超时
+	req = &testpb.TimeoutRequest{
+		DelaySeconds: 3,
+		Message:      "TimeoutRequest",
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = client.TimeoutCall(ctx, req)
+	require.Error(t, err)
+
+	assert.Equal(t, status.Code(err), codes.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Duration(req.DelaySeconds)*time.Second)
+
+	// 客户端取消
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	start = time.Now()
+	_, err = client.TimeoutCall(ctx, req)
+	require.Error(t, err)
+
+	assert.Equal(t, status.Code(err), codes.Canceled)
+	assert.Less(t, time.Since(start), time.Duration(req.DelaySeconds)*time.Second)
+}
+func MetadataCall(t *testing.T, client testpb.TestServiceClient) {
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "client-key", "client-value")
+	req := &testpb.MetadataRequest{
+		Key:   "client-key",
+		Value: "client-value",
+	}
+	var header, trailer metadata.MD
+	resp, err := client.MetadataCall(ctx, req, grpc.Header(&header), grpc.Trailer(&trailer))
+	require.NoError(t, err)
+
+	assert.Equal(t, resp.ReceivedMetadata[req.Key], req.Value)
+	assert.Equal(t, resp.Result, fmt.Sprintf("Processed metadata call with key: %s, value: %s", req.Key, req.Value))
+
+	// 响应头和尾部分开到达
+	assert.Equal(t, header.Get("server-response"), []string{"metadata-call-response"})
+	assert.NotEmpty(t, header.Get("timestamp"))
+	assert.Empty(t, header.Get("processing-time"))
+
+	assert.Equal(t, trailer.Get("processing-time"), []string{"fast"})
+	assert.Equal(t, trailer.Get("server-version"), []string{"1.0.0"})
+	assert.Empty(t, trailer.Get("server-response"))
+}
 func AuthCall(t *testing.T, client testpb.TestServiceClient, ctx context.Context) {
 	req := &testpb.AuthRequest{
 		Token:  "valid-token-123",
@@ -3,12 +3,20 @@ package test
 import (
 	"context"
 	"testing"
+	"time"
 
+	"grpchub-test/hub"
 	"grpchub-test/test/utils"
 
 	"github.com/lisoboss/grpchub-go/grpcx"
 	"github.com/lisoboss/grpchub-go/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 func TestNormalService_Error(t *testing.T) {
@@ -41,8 +49,28 @@ func TestNormalService_Auth(t *testing.T) {
 	BidirectionalStream(t, client, ctx)
 }
 
+func TestNormalService_Timeout(t *testing.T) {
+	addr, stopS := utils.StartServer(t, false)
+	defer stopS()
+	client, stopC := utils.StartClient(t, addr)
+	defer stopC()
+
+	TimeoutCall(t, client)
+}
+
+func TestNormalService_Metadata(t *testing.T) {
+	addr, stopS := utils.StartServer(t, false)
+	defer stopS()
+	client, stopC := utils.StartClient(t, addr)
+	defer stopC()
+
+	MetadataCall(t, client)
+}
+
 func TestHubService_NoAuth(t *testing.T) {
 	var name = "no-auth"
+	stopH := utils.StartHub(t)
+	defer stopH()
 	stopS := utils.StartHubServer(t, name)
 	defer stopS()
 	client, stopC := utils.StartHubClient(t, name)
@@ -54,6 +82,8 @@ func TestHubService_NoAuth(t *testing.T) {
 
 func TestHubService_Auth(t *testing.T) {
 	var name = "auth"
+	stopH := utils.StartHub(t)
+	defer stopH()
 	stopS := utils.StartHubServer(t, name,
 		grpcx.Middleware(
 			Auth("111111"),
@@ -79,6 +109,8 @@ func TestHubService_Auth(t *testing.T) {
 
 func TestHubService_WrappedMiddleware(t *testing.T) {
 	var name = "wrapped-middleware"
+	stopH := utils.StartHub(t)
+	defer stopH()
 	stopS := utils.StartHubServer(t, name,
 		grpcx.Middleware(
 			Auth("111111"),
@@ -105,3 +137,67 @@ func TestHubService_WrappedMiddleware(t *testing.T) {
 	AuthCall(t, client, ctx)
 	BidirectionalStream(t, client, ctx)
 }
+
+func TestHubService_Timeout(t *testing.T) {
+	// 等待 grpchub-go 实现：grpcx.NewClient 发送 grpc-timeout 和 PT_CANCEL，
+	// grpcx.NewServer 据此取消 handler 的上下文
+	t.Skip("needs grpchub-go to send grpc-timeout and PT_CANCEL and to cancel handlers on them")
+	var name = "timeout"
+	stopH := utils.StartHub(t)
+	defer stopH()
+	handlerErrs := make(chan error, 2)
+	stopS := utils.StartHubServer(t, name,
+		grpcx.Middleware(
+			HandlerDone(handlerErrs),
+		),
+	)
+	defer stopS()
+	client, stopC := utils.StartHubClient(t, name)
+	defer stopC()
+
+	TimeoutCall(t, client)
+
+	// 客户端的超时和取消都应传到服务端 handler
+	for _, want := range []error{context.DeadlineExceeded, context.Canceled} {
+		select {
+		case err := <-handlerErrs:
+			assert.ErrorIs(t, err, want)
+		case <-time.After(time.Second):
+			t.Fatalf("server handler was not canceled, want %v", want)
+		}
+	}
+}
+
+func TestHubService_Metadata(t *testing.T) {
+	// 等待 grpchub-go 实现：服务端发送 PT_TRAILER，
+	// 客户端支持 grpc.Header/grpc.Trailer 调用选项
+	t.Skip("needs grpchub-go to send PT_TRAILER and to support the grpc.Header and grpc.Trailer call options")
+	var name = "metadata"
+	stopH := utils.StartHub(t)
+	defer stopH()
+	stopS := utils.StartHubServer(t, name)
+	defer stopS()
+	client, stopC := utils.StartHubClient(t, name)
+	defer stopC()
+
+	MetadataCall(t, client)
+}
+
+func TestHubService_Offline(t *testing.T) {
+	var name = "offline"
+	stopH := utils.StartHub(t)
+	defer stopH()
+	client, stopC := utils.StartHubClient(t, name)
+	defer stopC()
+
+	_, err := client.EmptyCall(context.Background(), &emptypb.Empty{})
+	require.Error(t, err)
+
+	st := status.Convert(err)
+	assert.Equal(t, codes.Unavailable, st.Code())
+	require.Len(t, st.Details(), 1)
+	info, ok := st.Details()[0].(*errdetails.ErrorInfo)
+	require.True(t, ok)
+	assert.Equal(t, hub.ReasonComponentOffline, info.GetReason())
+	assert.Equal(t, hub.ErrorDomain, info.GetDomain())
+}
@@ -1,16 +1,25 @@
 package utils
 
 import (
+	"crypto/tls"
 	"log/slog"
+	"net"
 	"os"
+	"sync"
 	"testing"
 
+	"grpchub-test/capture"
 	testpb "grpchub-test/gen/test"
+	"grpchub-test/hub"
 	"grpchub-test/internal/service"
 
 	"github.com/lisoboss/grpchub-go"
 	"github.com/lisoboss/grpchub-go/grpcx"
 	"github.com/lisoboss/grpchub-go/utils"
+	"github.com/lisoboss/grpchub/grpchub-go-contrib/certs"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 const (
@@ -20,6 +29,69 @@ const (
 
 var logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
 
+var (
+	captureOnce   sync.Once
+	captureWriter *capture.Writer
+	captureErr    error
+)
+
+// openCapture opens GRPCHUB_CAPTURE once per test binary in append mode,
+// so every hub a run starts records into the same file instead of
+// truncating what the previous test captured. It returns nil if the
+// variable is unset.
+func openCapture() (*capture.Writer, error) {
+	captureOnce.Do(func() {
+		path := os.Getenv("GRPCHUB_CAPTURE")
+		if path == "" {
+			return
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			captureErr = err
+			return
+		}
+		captureWriter = capture.NewWriter(f)
+	})
+	return captureWriter, captureErr
+}
+
+// StartHub runs an in-process hub on hubAddr, using ./server.pem the same
+// way grpchub-serve does (identity and client CA root from one file, see
+// certs.LoadKeyPair).
+// If GRPCHUB_CAPTURE names a file, the hub appends its traffic there; read
+// it with `grpchub capture print`.
+func StartHub(t *testing.T) (stop func()) {
+	cert, clientCAs, err := certs.LoadKeyPair("./server.pem")
+	require.NoError(t, err)
+
+	grpcSrv := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	})))
+	opts := []hub.Option{hub.WithLogger(logger)}
+	cw, err := openCapture()
+	require.NoError(t, err)
+	if cw != nil {
+		opts = append(opts, hub.WithCapture(cw))
+	}
+	hub.NewServer(opts...).Register(grpcSrv)
+
+	lis, err := net.Listen("tcp", hubAddr)
+	require.NoError(t, err)
+
+	go func() {
+		_ = grpcSrv.Serve(lis)
+	}()
+
+	return func() {
+		grpcSrv.Stop()
+		if cw != nil {
+			_ = cw.Flush()
+		}
+	}
+}
+
 func newGHC() *grpchub.GrpcHubClient {
 	caPEM, certPEM, keyPEM, err := utils.LoadTLSCredentialsFromPEM("./client.pem")
 	if err != nil {
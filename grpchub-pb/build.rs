@@ -10,6 +10,7 @@ fn main() -> Result<(), Box<dyn std::error::Error>> {
             &[
                 "../proto/channel/v1/channel.proto",
                 "../third_party/google/rpc/status.proto",
+                "../third_party/google/rpc/error_details.proto",
             ],
             &["../proto/", "../third_party"],
         )?;
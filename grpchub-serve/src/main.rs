@@ -14,11 +14,19 @@ struct Args {
     /// Pem of the TLS PEM file path
     #[arg(short, long, default_value = "./server.pem")]
     pem: PathBuf,
+
+    /// Reject Channel streams whose sender_id or group_id is not the CN, a DNS SAN or a URI SAN of the client certificate
+    #[arg(long, env = "GRPCHUB_VERIFY_IDENTITY")]
+    verify_identity: bool,
 }
 
 #[tokio::main]
 async fn main() -> Result<(), Box<dyn std::error::Error>> {
-    let Args { addr, pem } = Args::parse();
+    let Args {
+        addr,
+        pem,
+        verify_identity,
+    } = Args::parse();
     let addr = addr.to_socket_addrs().unwrap().next().unwrap();
     println!("Listening: {addr}");
 
@@ -32,7 +40,7 @@ async fn main() -> Result<(), Box<dyn std::error::Error>> {
 
     Server::builder()
         .tls_config(tls)?
-        .add_service(server::new_service())
+        .add_service(server::new_service(verify_identity))
         .add_service(server::new_health_service().await)
         .add_service(server::new_reflection_service())
         .serve(addr)
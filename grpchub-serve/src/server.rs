@@ -4,31 +4,195 @@ use grpchub_pb::grpchub::{
     channel::{self, ChannelMessage},
 };
 use std::{pin::Pin, sync::Arc};
-use tokio::sync::mpsc;
-use tokio_stream::{Stream, StreamExt, wrappers::ReceiverStream};
+use tokio::sync::{broadcast, mpsc};
+use tokio_stream::{
+    Stream, StreamExt,
+    wrappers::{BroadcastStream, ReceiverStream},
+};
 use tonic::{Request, Response, Status, Streaming, codec::CompressionEncoding};
 use tonic_health::pb::health_server::{Health, HealthServer};
+use x509_parser::{certificate::X509Certificate, extensions::GeneralName, prelude::FromDer};
+
+/// ErrorInfo.domain of errors produced by the hub itself
+const ERROR_DOMAIN: &str = "grpchub";
+/// ErrorInfo.reason when the receiver is not registered
+const REASON_COMPONENT_OFFLINE: &str = "COMPONENT_OFFLINE";
+/// PT_HEADER metadata key the hub sets to the sending component ID
+const SENDER_ID_HEADER: &str = "grpchub-sender-id";
 
 type ChannelResult<T> = Result<Response<T>, Status>;
 type ChannelStream = Pin<Box<dyn Stream<Item = Result<channel::ChannelMessage, Status>> + Send>>;
-type ChannelMap = Arc<DashMap<String, mpsc::Sender<Result<channel::ChannelMessage, Status>>>>;
+type WatchComponentsStream =
+    Pin<Box<dyn Stream<Item = Result<channel::WatchComponentsResponse, Status>> + Send>>;
+type ChannelSender = mpsc::Sender<Result<channel::ChannelMessage, Status>>;
+type ChannelMap = Arc<DashMap<String, ChannelSender>>;
+type EventSender = broadcast::Sender<channel::WatchComponentsResponse>;
 
 #[derive(Debug)]
 pub struct ChannelServer {
     channels: ChannelMap,
+    groups: Arc<Groups>,
+    events: EventSender,
+    // sender_id 与 group_id 须与客户端证书的 CN 或 SAN 一致
+    verify_identity: bool,
 }
 
 impl ChannelServer {
-    pub fn new() -> Self {
+    pub fn new(verify_identity: bool) -> Self {
+        let (events, _) = broadcast::channel(64);
         Self {
             channels: Arc::new(DashMap::new()),
+            groups: Arc::new(Groups::default()),
+            events,
+            verify_identity,
         }
     }
 }
 
+/// 组件组：多个副本以各自的 sender_id 注册并通过 group_id 加入同一组，
+/// 发往组名的新 sid 按组轮询分配给成员，同一 sid 始终发往同一成员。
+///
+/// 绑定持续到调用方发送 PT_CANCEL/PT_ERROR、成员发送 PT_CLOSE/PT_ERROR，
+/// 或任一方断开。调用方的 PT_CLOSE 只是半关闭，之后的包仍发往同一成员。
+#[derive(Debug, Default)]
+struct Groups {
+    groups: DashMap<String, Group>,
+    // (sender_id, sid) => 绑定的成员；调用方重连后 sid 重新编号，
+    // 会话属于发起它的通道而不是 sender_id
+    sessions: DashMap<(String, String), Session>,
+}
+
+#[derive(Debug, Default)]
+struct Group {
+    members: Vec<String>,
+    next: usize,
+}
+
+#[derive(Debug)]
+struct Session {
+    group_id: String,
+    caller: ChannelSender,
+    member: ChannelSender,
+}
+
+impl Groups {
+    fn contains(&self, group_id: &str) -> bool {
+        self.groups.contains_key(group_id)
+    }
+
+    fn join(&self, group_id: &str, member_id: &str) {
+        let mut group = self.groups.entry(group_id.to_string()).or_default();
+        if !group.members.iter().any(|m| m == member_id) {
+            group.members.push(member_id.to_string());
+        }
+    }
+
+    fn leave(&self, group_id: &str, member_id: &str) {
+        if let Some(mut group) = self.groups.get_mut(group_id) {
+            group.members.retain(|m| m != member_id);
+        }
+        self.groups
+            .remove_if(group_id, |_, group| group.members.is_empty());
+    }
+
+    /// caller 通道上的 sid 是否有进行中的会话
+    fn has_session(&self, sender_id: &str, sid: &str, caller: &ChannelSender) -> bool {
+        self.sessions
+            .get(&(sender_id.to_string(), sid.to_string()))
+            .is_some_and(|session| session.caller.same_channel(caller))
+    }
+
+    /// 返回 caller 通道上 sid 绑定的成员通道，没有则在组内轮询选一个并绑定；
+    /// 同一 sid 属于调用方的旧通道时视为新会话
+    fn pick(
+        &self,
+        channels: &ChannelMap,
+        sender_id: &str,
+        caller: &ChannelSender,
+        group_id: &str,
+        sid: &str,
+    ) -> Option<ChannelSender> {
+        let key = (sender_id.to_string(), sid.to_string());
+        if let Some(session) = self.sessions.get(&key) {
+            if session.caller.same_channel(caller) {
+                return Some(session.member.clone());
+            }
+        }
+
+        let member = {
+            let mut group = self.groups.get_mut(group_id)?;
+            if group.members.is_empty() {
+                return None;
+            }
+            let i = group.next % group.members.len();
+            group.next = group.next.wrapping_add(1);
+            group.members[i].clone()
+        };
+        let tx = channels.get(&member)?.value().clone();
+        self.sessions.insert(
+            key,
+            Session {
+                group_id: group_id.to_string(),
+                caller: caller.clone(),
+                member: tx.clone(),
+            },
+        );
+        Some(tx)
+    }
+
+    /// 调用方结束会话
+    fn end_session(&self, sender_id: &str, sid: &str, caller: &ChannelSender) {
+        self.sessions
+            .remove_if(&(sender_id.to_string(), sid.to_string()), |_, session| {
+                session.caller.same_channel(caller)
+            });
+    }
+
+    /// 成员结束会话：只解除绑定在该成员通道上的 sid
+    fn end_member_session(&self, caller_id: &str, sid: &str, tx: &ChannelSender) {
+        self.sessions
+            .remove_if(&(caller_id.to_string(), sid.to_string()), |_, session| {
+                session.member.same_channel(tx)
+            });
+    }
+
+    /// 通道断开：删除它发起的会话和绑定在它上面的会话，
+    /// 返回后者的 (调用方通道, sid, 组名)。同一组件重连后的新通道发起的会话保留
+    fn end_channel(&self, tx: &ChannelSender) -> Vec<(ChannelSender, String, String)> {
+        let mut lost = Vec::new();
+        self.sessions.retain(|(_, sid), session| {
+            if session.caller.same_channel(tx) {
+                return false;
+            }
+            if session.member.same_channel(tx) {
+                lost.push((
+                    session.caller.clone(),
+                    sid.clone(),
+                    session.group_id.clone(),
+                ));
+                return false;
+            }
+            true
+        });
+        lost
+    }
+}
+
+/// 只能属于进行中会话的包类型，不会开启新会话
+fn ends_session(t: channel::PackageType) -> bool {
+    matches!(
+        t,
+        channel::PackageType::PtClose
+            | channel::PackageType::PtError
+            | channel::PackageType::PtCancel
+            | channel::PackageType::PtWindowUpdate
+    )
+}
+
 #[tonic::async_trait]
 impl channel::channel_service_server::ChannelService for ChannelServer {
     type ChannelStream = ChannelStream;
+    type WatchComponentsStream = WatchComponentsStream;
 
     async fn channel(
         &self,
@@ -37,38 +201,119 @@ impl channel::channel_service_server::ChannelService for ChannelServer {
         let md = request.metadata();
         let sender_id = parse_metadata_value(md, "sender_id")?.to_string();
         let receiver_id = parse_metadata_value(md, "receiver_id")?.to_string();
+        let group_id = md
+            .get("group_id")
+            .and_then(|v| v.to_str().ok())
+            .map(str::to_string);
+        if self.verify_identity {
+            let identities = peer_identities(&request)?;
+            verify_identity(&identities, &sender_id)?;
+            if let Some(group_id) = &group_id {
+                verify_identity(&identities, group_id)?;
+            }
+        }
 
         let mut stream = request.into_inner();
         // 初始化通道
         let (tx, rx) = mpsc::channel(32);
 
         // 注册信息
-        self.channels.insert(sender_id.clone(), tx.clone());
+        if self
+            .channels
+            .insert(sender_id.clone(), tx.clone())
+            .is_none()
+        {
+            let _ = self.events.send(new_component_event(
+                channel::ComponentEventType::Online,
+                &sender_id,
+            ));
+        }
+        if let Some(group_id) = &group_id {
+            self.groups.join(group_id, &sender_id);
+        }
         println!("Client connected: {}", sender_id);
 
         let channels = self.channels.clone();
+        let groups = self.groups.clone();
+        let events = self.events.clone();
         tokio::spawn(async move {
-            while let Some(Ok(msg)) = stream.next().await {
-                if let Some(tx) = channels.get(&receiver_id) {
-                    let t = match &msg.pkg {
-                        Some(pkg) => pkg.r#type(),
-                        _ => channel::PackageType::PtUnknown,
-                    };
+            while let Some(Ok(mut msg)) = stream.next().await {
+                let t = match &msg.pkg {
+                    Some(pkg) => pkg.r#type(),
+                    _ => channel::PackageType::PtUnknown,
+                };
+                // 由 hub 写入真实的发送方，调用方无法伪造
+                if t == channel::PackageType::PtHeader {
+                    if let Some(pkg) = msg.pkg.as_mut() {
+                        stamp_sender_id(pkg, &sender_id);
+                    }
+                }
+                // 组成员结束了会话
+                if matches!(
+                    t,
+                    channel::PackageType::PtClose | channel::PackageType::PtError
+                ) {
+                    groups.end_member_session(&receiver_id, &msg.sid, &tx);
+                }
+
+                // receiver_id 是组名时按 sid 选择成员
+                let grouped = !channels.contains_key(&receiver_id) && groups.contains(&receiver_id);
+                let target_tx = if grouped {
+                    // 已结束会话上迟到的包直接丢弃
+                    if ends_session(t) && !groups.has_session(&sender_id, &msg.sid, &tx) {
+                        continue;
+                    }
+                    let target_tx = groups.pick(&channels, &sender_id, &tx, &receiver_id, &msg.sid);
+                    if matches!(
+                        t,
+                        channel::PackageType::PtCancel | channel::PackageType::PtError
+                    ) {
+                        groups.end_session(&sender_id, &msg.sid, &tx);
+                    }
+                    target_tx
+                } else {
+                    channels.get(&receiver_id).map(|tx| tx.value().clone())
+                };
+
+                if let Some(target_tx) = target_tx {
                     println!("send {}({}) => {}", msg.sid, t.as_str_name(), receiver_id);
-                    let _ = tx.send(Ok(msg)).await;
+                    let _ = target_tx.send(Ok(msg)).await;
                 } else {
                     let _ = tx
                         .send(Ok(ChannelMessage {
                             sid: msg.sid,
-                            pkg: Some(new_error_not_found()),
+                            pkg: Some(new_error_not_found(&receiver_id)),
                         }))
                         .await;
-                    break;
+                    // 组内其他会话不受影响
+                    if !grouped {
+                        break;
+                    }
                 }
             }
 
-            // 下线清理
-            channels.remove(&sender_id);
+            // 下线清理；重连后的新通道已覆盖注册时不能删除
+            if channels
+                .remove_if(&sender_id, |_, v| v.same_channel(&tx))
+                .is_some()
+            {
+                if let Some(group_id) = &group_id {
+                    groups.leave(group_id, &sender_id);
+                }
+                let _ = events.send(new_component_event(
+                    channel::ComponentEventType::Offline,
+                    &sender_id,
+                ));
+            }
+            // 绑定在本通道上的会话通知调用方
+            for (caller_tx, sid, group_id) in groups.end_channel(&tx) {
+                let _ = caller_tx
+                    .send(Ok(ChannelMessage {
+                        sid,
+                        pkg: Some(new_error_not_found(&group_id)),
+                    }))
+                    .await;
+            }
             println!("Client disconnected: {}", sender_id);
         });
 
@@ -76,15 +321,86 @@ impl channel::channel_service_server::ChannelService for ChannelServer {
             Box::pin(ReceiverStream::new(rx)) as Self::ChannelStream
         ))
     }
+
+    async fn list_components(
+        &self,
+        _request: Request<channel::ListComponentsRequest>,
+    ) -> ChannelResult<channel::ListComponentsResponse> {
+        let mut component_ids: Vec<String> =
+            self.channels.iter().map(|e| e.key().clone()).collect();
+        component_ids.sort();
+
+        Ok(Response::new(channel::ListComponentsResponse {
+            component_ids,
+        }))
+    }
+
+    async fn watch_components(
+        &self,
+        _request: Request<channel::WatchComponentsRequest>,
+    ) -> ChannelResult<Self::WatchComponentsStream> {
+        // 先订阅再取快照，避免漏掉中间的变化；快照以 SNAPSHOT_END 结束
+        let events = BroadcastStream::new(self.events.subscribe());
+        let mut snapshot: Vec<Result<_, Status>> = self
+            .channels
+            .iter()
+            .map(|e| {
+                Ok(new_component_event(
+                    channel::ComponentEventType::Online,
+                    e.key(),
+                ))
+            })
+            .collect();
+        snapshot.push(Ok(new_component_event(
+            channel::ComponentEventType::SnapshotEnd,
+            "",
+        )));
+
+        let stream = tokio_stream::iter(snapshot)
+            .chain(events.map(|e| {
+                e.map_err(|e| Status::data_loss(format!("component events lagged: {e}")))
+            }));
+
+        Ok(Response::new(
+            Box::pin(stream) as Self::WatchComponentsStream
+        ))
+    }
+}
+
+fn new_component_event(
+    event_type: channel::ComponentEventType,
+    component_id: &str,
+) -> channel::WatchComponentsResponse {
+    channel::WatchComponentsResponse {
+        r#type: event_type as i32,
+        component_id: component_id.to_string(),
+    }
+}
+
+fn stamp_sender_id(pkg: &mut channel::MessagePackage, sender_id: &str) {
+    pkg.md.retain(|e| e.key != SENDER_ID_HEADER);
+    pkg.md.push(channel::MetadataEntry {
+        key: SENDER_ID_HEADER.to_string(),
+        values: vec![sender_id.to_string()],
+    });
 }
 
-fn new_error_not_found() -> channel::MessagePackage {
+fn new_error_not_found(component_id: &str) -> channel::MessagePackage {
     use prost::Message;
 
+    let info = grpchub_pb::google::rpc::ErrorInfo {
+        reason: REASON_COMPONENT_OFFLINE.to_string(),
+        domain: ERROR_DOMAIN.to_string(),
+        metadata: [("component_id".to_string(), component_id.to_string())].into(),
+    };
+
     let status = grpchub_pb::google::rpc::Status {
         code: 14, // UNAVAILABLE
         message: "target service is offline or not available".to_string(),
-        details: vec![],
+        details: vec![grpchub_pb::google::protobuf::Any {
+            type_url: "type.googleapis.com/google.rpc.ErrorInfo".to_string(),
+            value: info.encode_to_vec(),
+        }],
     };
 
     let mut buf = Vec::new();
@@ -98,6 +414,7 @@ fn new_error_not_found() -> channel::MessagePackage {
             value: buf,
         }),
         md: Vec::new(),
+        window_increment: 0,
     }
 }
 
@@ -113,8 +430,47 @@ fn parse_metadata_value<'a>(
     }
 }
 
-pub fn new_service() -> channel::channel_service_server::ChannelServiceServer<ChannelServer> {
-    let server = ChannelServer::new();
+/// 已验证的客户端证书中的 CN、DNS SAN 与 URI SAN
+fn peer_identities<T>(request: &Request<T>) -> Result<Vec<String>, Status> {
+    let certs = request
+        .peer_certs()
+        .ok_or_else(|| Status::unauthenticated("No verified client certificate"))?;
+    let leaf = certs
+        .first()
+        .ok_or_else(|| Status::unauthenticated("No verified client certificate"))?;
+    let (_, cert) = X509Certificate::from_der(leaf.as_ref())
+        .map_err(|e| Status::unauthenticated(format!("Bad client certificate: {e}")))?;
+
+    let mut identities: Vec<String> = cert
+        .subject()
+        .iter_common_name()
+        .filter_map(|cn| cn.as_str().ok())
+        .map(str::to_string)
+        .collect();
+    if let Ok(Some(san)) = cert.subject_alternative_name() {
+        for name in &san.value.general_names {
+            if let GeneralName::DNSName(id) | GeneralName::URI(id) = name {
+                identities.push(id.to_string());
+            }
+        }
+    }
+    Ok(identities)
+}
+
+fn verify_identity(identities: &[String], component_id: &str) -> Result<(), Status> {
+    if identities.iter().any(|id| id == component_id) {
+        Ok(())
+    } else {
+        Err(Status::permission_denied(format!(
+            "component {component_id:?} does not match the client certificate"
+        )))
+    }
+}
+
+pub fn new_service(
+    verify_identity: bool,
+) -> channel::channel_service_server::ChannelServiceServer<ChannelServer> {
+    let server = ChannelServer::new(verify_identity);
     let server = channel::channel_service_server::ChannelServiceServer::new(server)
         .send_compressed(CompressionEncoding::Zstd)
         .accept_compressed(CompressionEncoding::Zstd);